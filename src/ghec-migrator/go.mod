@@ -2,6 +2,8 @@ module github.com/bradshjg/ghec-migrator
 
 go 1.24.6
 
+require go.etcd.io/bbolt v1.4.3
+
 require (
 	github.com/PuerkitoBio/goquery v1.10.3 // indirect
 	github.com/a-h/parse v0.0.0-20250122154542-74294addb73e // indirect
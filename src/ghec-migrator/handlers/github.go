@@ -8,14 +8,16 @@ import (
 	"github.com/labstack/echo/v4"
 )
 
-func NewGitHubHandler(githubService services.GitHubService) *GitHubHandler {
+func NewGitHubHandler(githubService services.GitHubService, sourceService services.SourceService) *GitHubHandler {
 	return &GitHubHandler{
 		githubService: githubService,
+		sourceService: sourceService,
 	}
 }
 
 type GitHubHandler struct {
 	githubService services.GitHubService
+	sourceService services.SourceService
 }
 
 type OrgsQuery struct {
@@ -28,14 +30,28 @@ func (gh *GitHubHandler) OrgsHandler(c echo.Context) error {
 	if err != nil {
 		return err
 	}
+	data := views.OrgFormData{
+		ClientType:     orgsQuery.ClientType,
+		NamespaceLabel: "org",
+	}
+	if orgsQuery.ClientType == services.Source {
+		// the source may not be GitHub, in which case its orgs are whatever it groups repos by
+		provider, token, err := gh.sourceService.SessionProvider(c)
+		if err != nil {
+			return err
+		}
+		data.NamespaceLabel = provider.NamespaceLabel()
+		data.Orgs, err = provider.Namespaces(token)
+		if err != nil {
+			return err
+		}
+		return renderView(c, views.OrgsForm(data))
+	}
 	orgs, err := gh.githubService.Orgs(c, orgsQuery.ClientType)
 	if err != nil {
 		return err
 	}
-	data := views.OrgFormData{
-		Orgs:       orgs,
-		ClientType: orgsQuery.ClientType,
-	}
+	data.Orgs = orgs
 	return renderView(c, views.OrgsForm(data))
 }
 
@@ -55,7 +71,11 @@ func (gh *GitHubHandler) ReposHandler(c echo.Context) error {
 		}
 		return renderView(c, views.SourceRepoOptions(data))
 	}
-	repos, err := gh.githubService.Repos(c, services.Source, org.Name)
+	provider, token, err := gh.sourceService.SessionProvider(c)
+	if err != nil {
+		return err
+	}
+	repos, err := provider.Repos(token, org.Name)
 	if err != nil {
 		return err
 	}
@@ -64,3 +84,37 @@ func (gh *GitHubHandler) ReposHandler(c echo.Context) error {
 	}
 	return renderView(c, views.SourceRepoOptions(data))
 }
+
+type PermissionsQuery struct {
+	ClientType services.ClientType `query:"client"`
+	SourceOrg  string              `query:"source-org"`
+	TargetOrg  string              `query:"target-org"`
+}
+
+// PermissionsHandler explains what the session's token is missing to migrate out of (or into) the chosen org.
+func (gh *GitHubHandler) PermissionsHandler(c echo.Context) error {
+	pq := new(PermissionsQuery)
+	err := c.Bind(pq)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid request: %w", err)
+	}
+	var data views.PermissionsData
+	if pq.ClientType == services.Source {
+		if pq.SourceOrg != "" {
+			provider, token, err := gh.sourceService.SessionProvider(c)
+			if err != nil {
+				return err
+			}
+			err = provider.OrgPermissions(token, pq.SourceOrg)
+			if err != nil {
+				data.ErrMessage = err.Error()
+			}
+		}
+	} else if pq.TargetOrg != "" {
+		err = gh.githubService.OrgPermissions(c, services.Target, pq.TargetOrg)
+		if err != nil {
+			data.ErrMessage = err.Error()
+		}
+	}
+	return renderView(c, views.Permissions(data))
+}
@@ -0,0 +1,177 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+
+	"github.com/bradshjg/ghec-migrator/services"
+	"github.com/bradshjg/ghec-migrator/views"
+	"github.com/labstack/echo/v4"
+)
+
+func NewMannequinHandler(mannequinService services.MannequinService, githubService services.GitHubService) *MannequinHandler {
+	return &MannequinHandler{
+		mannequinService: mannequinService,
+		githubService:    githubService,
+	}
+}
+
+type MannequinHandler struct {
+	mannequinService services.MannequinService
+	githubService    services.GitHubService
+}
+
+func (mh *MannequinHandler) MannequinsHandler(c echo.Context) error {
+	data, err := mh.mannequinsData(c, c.QueryParam("org"))
+	if errors.Is(err, services.ErrTokenNotFound) {
+		// the target token is set on the index page
+		return c.Redirect(http.StatusFound, "/")
+	}
+	if errors.Is(err, services.ErrOrgRole) {
+		// using the GitHub App on an org its user doesn't own
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	if err != nil {
+		return err
+	}
+	return renderView(c, views.Mannequins(data))
+}
+
+func (mh *MannequinHandler) mannequinsData(c echo.Context, org string) (views.MannequinsData, error) {
+	orgs, err := mh.githubService.Orgs(c, services.Target)
+	if err != nil {
+		return views.MannequinsData{}, err
+	}
+	data := views.MannequinsData{
+		Orgs: orgs,
+		Org:  org,
+	}
+	if org != "" {
+		data.Mannequins, data.Reclaims, err = mh.mannequinService.Mannequins(c, org)
+	}
+	return data, err
+}
+
+type MannequinReclaims struct {
+	Org            string   `form:"org"`
+	MannequinUsers []string `form:"mannequin-user"`
+	MannequinIDs   []string `form:"mannequin-id"`
+	TargetUsers    []string `form:"target-user"`
+}
+
+func (mh *MannequinHandler) ReclaimHandler(c echo.Context) error {
+	mr := new(MannequinReclaims)
+	err := c.Bind(mr)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid request: %w", err)
+	}
+	if len(mr.MannequinIDs) != len(mr.MannequinUsers) || len(mr.MannequinIDs) != len(mr.TargetUsers) {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid request: every mannequin needs an ID and a target user")
+	}
+	var reclaims []services.MannequinReclaim
+	for i, id := range mr.MannequinIDs {
+		// mannequins without a target user are left as they are
+		if mr.TargetUsers[i] == "" {
+			continue
+		}
+		reclaims = append(reclaims, services.MannequinReclaim{
+			MannequinUser: mr.MannequinUsers[i],
+			MannequinID:   id,
+			TargetUser:    mr.TargetUsers[i],
+		})
+	}
+	_, err = mh.mannequinService.Reclaim(c, mr.Org, reclaims)
+	if errors.Is(err, services.ErrInvalidReclaim) {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	if errors.Is(err, services.ErrTokenNotFound) {
+		return c.Redirect(http.StatusFound, "/")
+	}
+	if errors.Is(err, services.ErrOrgRole) {
+		// using the GitHub App on an org its user doesn't own
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	if err != nil {
+		return err
+	}
+	// the reclaims are submitted in the background, and the page follows them until they are
+	return c.Redirect(http.StatusFound, "/mannequins?"+url.Values{"org": {mr.Org}}.Encode())
+}
+
+// DownloadCSVHandler serves an org's mannequins in the format of `gh gei generate-mannequin-csv`, filled in with who
+// each is (or is to be) reclaimed by.
+func (mh *MannequinHandler) DownloadCSVHandler(c echo.Context) error {
+	org := c.QueryParam("org")
+	if org == "" {
+		return echo.NewHTTPError(http.StatusBadRequest, "missing org")
+	}
+	mannequins, _, err := mh.mannequinService.Mannequins(c, org)
+	if errors.Is(err, services.ErrTokenNotFound) {
+		return c.Redirect(http.StatusFound, "/")
+	}
+	if errors.Is(err, services.ErrOrgRole) {
+		// using the GitHub App on an org its user doesn't own
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	if err != nil {
+		return err
+	}
+	var reclaims []services.MannequinReclaim
+	for _, m := range mannequins {
+		reclaims = append(reclaims, services.MannequinReclaim{
+			MannequinUser: m.Login,
+			MannequinID:   m.ID,
+			TargetUser:    m.Assignment(),
+		})
+	}
+	c.Response().Header().Set(echo.HeaderContentType, "text/csv")
+	c.Response().Header().Set(echo.HeaderContentDisposition, `attachment; filename="`+url.PathEscape(org)+`-mannequins.csv"`)
+	c.Response().WriteHeader(http.StatusOK)
+	return services.WriteMannequinCSV(c.Response(), reclaims)
+}
+
+// UploadCSVHandler fills in target users from an uploaded mannequin CSV, to be reviewed before they're reclaimed.
+func (mh *MannequinHandler) UploadCSVHandler(c echo.Context) error {
+	org := c.FormValue("org")
+	file, err := c.FormFile("csv")
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "missing CSV")
+	}
+	f, err := file.Open()
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	uploaded, err := services.ParseMannequinCSV(f)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	data, err := mh.mannequinsData(c, org)
+	if errors.Is(err, services.ErrTokenNotFound) {
+		return c.Redirect(http.StatusFound, "/")
+	}
+	if errors.Is(err, services.ErrOrgRole) {
+		// using the GitHub App on an org its user doesn't own
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	if err != nil {
+		return err
+	}
+	data.Uploaded = map[string]string{}
+	for _, reclaim := range uploaded {
+		found := false
+		for _, m := range data.Mannequins {
+			if m.ID == reclaim.MannequinID {
+				found = true
+				break
+			}
+		}
+		if !found {
+			data.Unmatched++
+			continue
+		}
+		data.Uploaded[reclaim.MannequinID] = reclaim.TargetUser
+	}
+	return renderView(c, views.Mannequins(data))
+}
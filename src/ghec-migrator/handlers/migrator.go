@@ -5,24 +5,41 @@ import (
 	"fmt"
 	"net/http"
 	"net/url"
+	"slices"
+	"strings"
+	"time"
 
 	"github.com/bradshjg/ghec-migrator/services"
 	"github.com/bradshjg/ghec-migrator/views"
 	"github.com/labstack/echo/v4"
 )
 
-func NewMigratorHandler(migratorService services.MigratorService) *MigratorHandler {
+func NewMigratorHandler(migratorService services.MigratorService, sourceService services.SourceService, target services.GitHubTarget) *MigratorHandler {
 	return &MigratorHandler{
 		migratorService: migratorService,
+		sourceService:   sourceService,
+		target:          target,
 	}
 }
 
 type MigratorHandler struct {
 	migratorService services.MigratorService
+	sourceService   services.SourceService
+	target          services.GitHubTarget
 }
 
 func (fh *MigratorHandler) IndexHandler(c echo.Context) error {
-	sourceErr := fh.migratorService.ValidToken(c, services.Source)
+	source, err := fh.tokenSource(c)
+	if err != nil {
+		return err
+	}
+	var sourceErr error
+	if sessionSource, _, err := fh.sourceService.SessionProvider(c); err == nil && sessionSource != source {
+		// picking another kind of source asks for its token, which replaces the one in the session
+		sourceErr = services.ErrTokenNotFound
+	} else {
+		sourceErr = fh.migratorService.ValidToken(c, services.Source)
+	}
 	var sourceErrMessage string
 	if sourceErr != nil {
 		sourceErrMessage = sourceErr.Error()
@@ -34,39 +51,173 @@ func (fh *MigratorHandler) IndexHandler(c echo.Context) error {
 	}
 	indexData := views.IndexData{
 		Source: views.AuthenticationData{
-			ClientType: services.Source,
-			Exists:     !errors.Is(sourceErr, services.ErrTokenNotFound),
-			Valid:      sourceErr == nil,
-			ErrMessage: sourceErrMessage,
+			ClientType:     services.Source,
+			Exists:         !errors.Is(sourceErr, services.ErrTokenNotFound),
+			Valid:          sourceErr == nil,
+			ErrMessage:     sourceErrMessage,
+			TokenURL:       source.TokenURL(),
+			Source:         source,
+			Sources:        fh.sourceService.Providers(),
+			AppAvailable:   source.App() != nil,
+			AppAdminSecret: source.App() != nil && source.App().AdminSecret != "",
+			OAuthAvailable: source.OAuth() != nil,
 		},
 		Target: views.AuthenticationData{
-			ClientType: services.Target,
-			Exists:     !errors.Is(targetErr, services.ErrTokenNotFound),
-			Valid:      targetErr == nil,
-			ErrMessage: targetErrMessage,
+			ClientType:     services.Target,
+			Exists:         !errors.Is(targetErr, services.ErrTokenNotFound),
+			Valid:          targetErr == nil,
+			ErrMessage:     targetErrMessage,
+			TokenURL:       fh.target.TokenURL(),
+			AppAvailable:   fh.target.App != nil,
+			AppAdminSecret: fh.target.App != nil && fh.target.App.AdminSecret != "",
+			OAuthAvailable: fh.target.OAuth != nil,
 		},
 	}
 	return renderView(c, views.Index(indexData))
 }
 
+// tokenSource is the source whose token form is shown: the one picked with ?source= (and &instance=), else the one
+// the session's source token is for, else the default.
+func (fh *MigratorHandler) tokenSource(c echo.Context) (services.SourceProvider, error) {
+	if kind := c.QueryParam("source"); kind != "" {
+		provider, err := fh.sourceService.Provider(services.SourceKind(kind), c.QueryParam("instance"))
+		if err != nil {
+			return nil, echo.NewHTTPError(http.StatusBadRequest, err.Error())
+		}
+		return provider, nil
+	}
+	if provider, _, err := fh.sourceService.SessionProvider(c); err == nil {
+		return provider, nil
+	}
+	return fh.sourceService.Providers()[0], nil
+}
+
 type Migration struct {
-	SourceOrg  string `form:"source-org"`
-	SourceRepo string `form:"source-repo"`
-	TargetOrg  string `form:"target-org"`
+	SourceOrg   string   `form:"source-org"`
+	SourceRepos []string `form:"source-repo"`
+	TargetOrg   string   `form:"target-org"`
+	DryRun      bool     `form:"dry-run"`
+	// ScheduledFor is a datetime-local value in the server's time zone, blank to start right away
+	ScheduledFor      string `form:"scheduled-for"`
+	TargetPrefix      string `form:"target-prefix"`
+	TargetSuffix      string `form:"target-suffix"`
+	TargetPattern     string `form:"target-pattern"`
+	TargetReplacement string `form:"target-replacement"`
+	// TargetNames has a `source-repo=target-repo` line per renamed repo
+	TargetNames string `form:"target-names"`
+	Options
+}
+
+// Options are the advanced options' inputs, shared by the migration and reschedule forms.
+type Options struct {
+	TargetVisibility string `form:"target-visibility"`
+	SkipReleases     bool   `form:"skip-releases"`
+	LockSource       bool   `form:"lock-source"`
+	KeepArchive      bool   `form:"keep-archive"`
+	QueueOnly        bool   `form:"queue-only"`
+	// alerts are migrated for each repo once it has migrated
+	MigrateCodeScanningAlerts bool `form:"migrate-code-scanning-alerts"`
+	MigrateSecretAlerts       bool `form:"migrate-secret-alerts"`
+}
+
+func (m *Options) options() (services.MigrationOptions, error) {
+	options := services.MigrationOptions{
+		TargetVisibility: m.TargetVisibility,
+		SkipReleases:     m.SkipReleases,
+		LockSource:       m.LockSource,
+		KeepArchive:      m.KeepArchive,
+		QueueOnly:        m.QueueOnly,
+
+		MigrateCodeScanningAlerts: m.MigrateCodeScanningAlerts,
+		MigrateSecretAlerts:       m.MigrateSecretAlerts,
+	}
+	if err := options.Validate(); err != nil {
+		return options, echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	return options, nil
+}
+
+func (m *Migration) targetNaming() (services.TargetNaming, error) {
+	naming := services.TargetNaming{
+		Prefix:      strings.TrimSpace(m.TargetPrefix),
+		Suffix:      strings.TrimSpace(m.TargetSuffix),
+		Pattern:     m.TargetPattern,
+		Replacement: m.TargetReplacement,
+	}
+	for line := range strings.Lines(m.TargetNames) {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		source, target, ok := strings.Cut(line, "=")
+		source, target = strings.TrimSpace(source), strings.TrimSpace(target)
+		if !ok || source == "" || target == "" {
+			return naming, echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("invalid target name mapping: %s", line))
+		}
+		if naming.Names == nil {
+			naming.Names = map[string]string{}
+		}
+		naming.Names[source] = target
+	}
+	if err := naming.Validate(); err != nil {
+		return naming, echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	return naming, nil
+}
+
+// scheduleLayout is the format of datetime-local inputs.
+const scheduleLayout = "2006-01-02T15:04"
+
+func parseSchedule(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	t, err := time.ParseInLocation(scheduleLayout, value, time.Local)
+	if err != nil {
+		return time.Time{}, echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("invalid start time: %s", value))
+	}
+	return t, nil
+}
+
+// migration is the form's migration, for c's session.
+func (m *Migration) migration(c echo.Context) (services.Migration, error) {
+	scheduledFor, err := parseSchedule(m.ScheduledFor)
+	if err != nil {
+		return services.Migration{}, err
+	}
+	targetNaming, err := m.targetNaming()
+	if err != nil {
+		return services.Migration{}, err
+	}
+	options, err := m.options()
+	if err != nil {
+		return services.Migration{}, err
+	}
+	return services.Migration{
+		Context:      c,
+		SourceOrg:    m.SourceOrg,
+		SourceRepos:  slices.DeleteFunc(m.SourceRepos, func(r string) bool { return r == "" }),
+		TargetOrg:    m.TargetOrg,
+		TargetNaming: targetNaming,
+		Options:      options,
+		DryRun:       m.DryRun,
+		ScheduledFor: scheduledFor,
+	}, nil
 }
 
 func (mh *MigratorHandler) StartRunHandler(c echo.Context) error {
 	migration := new(Migration)
 	c.Bind(migration)
-	migrationData := services.Migration{
-		Context:    c,
-		SourceOrg:  migration.SourceOrg,
-		SourceRepo: migration.SourceRepo,
-		TargetOrg:  migration.TargetOrg,
+	migrationData, err := migration.migration(c)
+	if err != nil {
+		return err
 	}
 	token, err := mh.migratorService.Run(migrationData)
 	if err != nil {
-		return fmt.Errorf("error handling run: %w", err)
+		return runError(c, err)
+	}
+	if migrationData.ScheduledFor.After(time.Now()) {
+		return c.Redirect(http.StatusFound, fmt.Sprintf("/runs/%s", url.PathEscape(token)))
 	}
 	queryParams := url.Values{}
 	queryParams.Set("token", token)
@@ -74,8 +225,129 @@ func (mh *MigratorHandler) StartRunHandler(c echo.Context) error {
 	return c.Redirect(http.StatusFound, targetURL)
 }
 
+// ReadinessHandler starts checking the form's migration without starting it, showing the check's progress until its
+// report is ready.
+func (mh *MigratorHandler) ReadinessHandler(c echo.Context) error {
+	migration := new(Migration)
+	c.Bind(migration)
+	migrationData, err := migration.migration(c)
+	if err != nil {
+		return err
+	}
+	id, err := mh.migratorService.Readiness(migrationData)
+	if errors.Is(err, services.ErrTargetNameCollision) {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	if err != nil {
+		return fmt.Errorf("error checking readiness: %w", err)
+	}
+	return renderView(c, views.ReadinessProgress(id, services.ReadinessCheck{}))
+}
+
+// ReadinessCheckHandler is polled for a readiness check's progress, and renders its report once it's done.
+func (mh *MigratorHandler) ReadinessCheckHandler(c echo.Context) error {
+	id := c.Param("id")
+	check, err := mh.migratorService.ReadinessCheck(id)
+	if errors.Is(err, services.ErrReadinessCheckNotFound) {
+		return echo.NewHTTPError(http.StatusNotFound, err.Error())
+	}
+	if err != nil {
+		return fmt.Errorf("error getting readiness check: %w", err)
+	}
+	if !check.Done {
+		return renderView(c, views.ReadinessProgress(id, check))
+	}
+	if check.Err != nil {
+		// shown in place of the report, which also stops the polling
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("error checking readiness: %v", check.Err))
+	}
+	c.Response().Writer.WriteHeader(StopPollingStatus)
+	return renderView(c, views.Readiness(check.Report))
+}
+
+// runError responds to a run that couldn't be started, which is the user's to fix unless it's unexpected.
+func runError(c echo.Context, err error) error {
+	var notReady *services.NotReadyError
+	if errors.As(err, &notReady) {
+		// the report is shown in place of the run, with what's blocking it
+		c.Response().Header().Set(echo.HeaderContentType, echo.MIMETextHTML)
+		c.Response().WriteHeader(http.StatusBadRequest)
+		return renderView(c, views.Readiness(notReady.Report))
+	}
+	if errors.Is(err, services.ErrTargetNameCollision) || errors.Is(err, services.ErrUnsupportedOption) || errors.Is(err, services.ErrMissingPermission) || errors.Is(err, services.ErrOrgRole) {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	return fmt.Errorf("error handling run: %w", err)
+}
+
+func (mh *MigratorHandler) RetryHandler(c echo.Context) error {
+	token, err := mh.migratorService.Retry(c, c.Param("id"))
+	switch {
+	case errors.Is(err, services.ErrRunNotFound):
+		return echo.NewHTTPError(http.StatusNotFound, err.Error())
+	case errors.Is(err, services.ErrRunNotFinished), errors.Is(err, services.ErrNothingToRetry), errors.Is(err, services.ErrSourceMismatch):
+		return echo.NewHTTPError(http.StatusConflict, err.Error())
+	case err != nil:
+		return runError(c, err)
+	}
+	queryParams := url.Values{}
+	queryParams.Set("token", token)
+	targetURL := fmt.Sprintf("/run?%s", queryParams.Encode())
+	return c.Redirect(http.StatusFound, targetURL)
+}
+
+type Schedule struct {
+	ScheduledFor string `form:"scheduled-for"`
+	// SourceRepos has a repo per line, blank for every repo in the source org
+	SourceRepos string `form:"source-repos"`
+	Options
+}
+
+func (mh *MigratorHandler) RescheduleHandler(c echo.Context) error {
+	var schedule Schedule
+	err := c.Bind(&schedule)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid request: %w", err)
+	}
+	scheduledFor, err := parseSchedule(schedule.ScheduledFor)
+	if err != nil {
+		return err
+	}
+	if scheduledFor.IsZero() {
+		scheduledFor = time.Now()
+	}
+	options, err := schedule.options()
+	if err != nil {
+		return err
+	}
+	var sourceRepos []string
+	for line := range strings.Lines(schedule.SourceRepos) {
+		if repo := strings.TrimSpace(line); repo != "" {
+			sourceRepos = append(sourceRepos, repo)
+		}
+	}
+	id := c.Param("id")
+	err = mh.migratorService.Reschedule(c, id, services.ScheduleEdit{
+		ScheduledFor: scheduledFor,
+		SourceRepos:  sourceRepos,
+		Options:      options,
+	})
+	switch {
+	case errors.Is(err, services.ErrRunNotFound):
+		return echo.NewHTTPError(http.StatusNotFound, err.Error())
+	case errors.Is(err, services.ErrRunNotScheduled):
+		return echo.NewHTTPError(http.StatusConflict, err.Error())
+	case errors.Is(err, services.ErrTokenNotFound):
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	case err != nil:
+		return runError(c, err)
+	}
+	return c.Redirect(http.StatusFound, fmt.Sprintf("/runs/%s", url.PathEscape(id)))
+}
+
 type Output struct {
 	Token string `query:"token"`
+	From  int    `query:"from"` // output lines the page already has
 }
 
 const StopPollingStatus = 286
@@ -98,7 +370,10 @@ func (mh *MigratorHandler) OutputHandler(c echo.Context) error {
 	if err != nil {
 		return echo.NewHTTPError(http.StatusBadRequest, "invalid request: %w", err)
 	}
-	lines, done, err := mh.migratorService.Output(output.Token)
+	lines, done, err := mh.migratorService.Output(output.Token, output.From)
+	if errors.Is(err, services.ErrRunNotFound) {
+		return echo.NewHTTPError(http.StatusNotFound, err.Error())
+	}
 	if err != nil {
 		return fmt.Errorf("error getting output: %w", err)
 	}
@@ -108,5 +383,44 @@ func (mh *MigratorHandler) OutputHandler(c echo.Context) error {
 	outputData := views.OutputData{
 		Lines: lines,
 	}
-	return renderView(c, views.Output(outputData))
+	return renderView(c, views.PolledOutput(outputData, output.From))
+}
+
+func (mh *MigratorHandler) QueueHandler(c echo.Context) error {
+	var output Output
+	err := c.Bind(&output)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid request: %w", err)
+	}
+	position := mh.migratorService.QueuePosition(output.Token)
+	if position == 0 {
+		c.Response().Writer.WriteHeader(StopPollingStatus)
+	}
+	data := views.QueuePositionData{
+		Position: position,
+	}
+	return renderView(c, views.QueuePosition(data))
+}
+
+type Cancel struct {
+	Token string `form:"token"`
+}
+
+func (mh *MigratorHandler) CancelHandler(c echo.Context) error {
+	var cancel Cancel
+	err := c.Bind(&cancel)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid request: %w", err)
+	}
+	err = mh.migratorService.Cancel(c, cancel.Token)
+	if errors.Is(err, services.ErrRunNotActive) {
+		return echo.NewHTTPError(http.StatusConflict, err.Error())
+	}
+	if errors.Is(err, services.ErrTokenNotFound) || errors.Is(err, services.ErrOrgRole) || errors.Is(err, services.ErrMissingPermission) {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	if err != nil {
+		return fmt.Errorf("error cancelling run: %w", err)
+	}
+	return c.String(http.StatusOK, "cancelling...")
 }
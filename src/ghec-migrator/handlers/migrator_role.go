@@ -0,0 +1,76 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+
+	"github.com/bradshjg/ghec-migrator/services"
+	"github.com/bradshjg/ghec-migrator/views"
+	"github.com/labstack/echo/v4"
+)
+
+func NewMigratorRoleHandler(migratorRoleService services.MigratorRoleService, githubService services.GitHubService) *MigratorRoleHandler {
+	return &MigratorRoleHandler{
+		migratorRoleService: migratorRoleService,
+		githubService:       githubService,
+	}
+}
+
+type MigratorRoleHandler struct {
+	migratorRoleService services.MigratorRoleService
+	githubService       services.GitHubService
+}
+
+func (mh *MigratorRoleHandler) MigratorRolesHandler(c echo.Context) error {
+	orgs, err := mh.githubService.Orgs(c, services.Target)
+	if errors.Is(err, services.ErrTokenNotFound) {
+		// the target token is set on the index page
+		return c.Redirect(http.StatusFound, "/")
+	}
+	if err != nil {
+		return err
+	}
+	data := views.MigratorRolesData{
+		Orgs: orgs,
+		Org:  c.QueryParam("org"),
+	}
+	if data.Org != "" {
+		data.Holders, data.Changes, err = mh.migratorRoleService.Holders(data.Org)
+		if err != nil {
+			return err
+		}
+	}
+	return renderView(c, views.MigratorRoles(data))
+}
+
+type MigratorRoleChange struct {
+	Org       string `form:"org"`
+	Actor     string `form:"actor"`
+	ActorType string `form:"actor-type"`
+	Revoke    bool   `form:"revoke"`
+}
+
+func (mh *MigratorRoleHandler) ChangeMigratorRoleHandler(c echo.Context) error {
+	rc := new(MigratorRoleChange)
+	err := c.Bind(rc)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid request: %w", err)
+	}
+	_, err = mh.migratorRoleService.Change(c, rc.Org, services.MigratorRoleChange{
+		Actor:     rc.Actor,
+		ActorType: services.MigratorActorType(rc.ActorType),
+		Revoke:    rc.Revoke,
+	})
+	if errors.Is(err, services.ErrInvalidRoleChange) || errors.Is(err, services.ErrOrgRole) || errors.Is(err, services.ErrMissingPermission) || errors.Is(err, services.ErrAppNotConfigured) {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	if errors.Is(err, services.ErrTokenNotFound) {
+		return c.Redirect(http.StatusFound, "/")
+	}
+	if err != nil {
+		return err
+	}
+	// the change shows in the list of changes, with its output a click away once it's done
+	return c.Redirect(http.StatusFound, "/migrators?"+url.Values{"org": {rc.Org}}.Encode())
+}
@@ -0,0 +1,118 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/bradshjg/ghec-migrator/services"
+	"github.com/labstack/echo/v4"
+)
+
+// NewOAuthHandler takes the URL users reach the server at, which the callback URL registered for each OAuth App has to
+// be under. It's configured rather than taken from requests so their Host header can't redirect a sign-in elsewhere.
+func NewOAuthHandler(tokenService services.TokenService, sourceService services.SourceService, target services.GitHubTarget, baseURL string) *OAuthHandler {
+	return &OAuthHandler{
+		tokenService:  tokenService,
+		sourceService: sourceService,
+		target:        target,
+		callbackURL:   strings.TrimSuffix(baseURL, "/") + "/oauth/callback",
+	}
+}
+
+// OAuthHandler signs users in with a side's OAuth App, storing the resulting token like a pasted one.
+type OAuthHandler struct {
+	tokenService  services.TokenService
+	sourceService services.SourceService
+	target        services.GitHubTarget
+	callbackURL   string // where GitHub sends users back to, which has to match the OAuth App's callback URL
+}
+
+type AuthorizeQuery struct {
+	ClientType     services.ClientType `query:"client"`
+	SourceKind     services.SourceKind `query:"source"`
+	SourceInstance string              `query:"instance"`
+}
+
+func (oh *OAuthHandler) AuthorizeHandler(c echo.Context) error {
+	aq := new(AuthorizeQuery)
+	err := c.Bind(aq)
+	if err != nil {
+		return err
+	}
+	if err := aq.ClientType.Validate(); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	token := services.Token{
+		Type:           aq.ClientType,
+		SourceKind:     aq.SourceKind,
+		SourceInstance: aq.SourceInstance,
+	}
+	app, err := oh.oauthApp(token)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	state, err := services.NewOAuthState(token)
+	if err != nil {
+		return err
+	}
+	err = oh.tokenService.StoreOAuthState(c, state)
+	if err != nil {
+		return err
+	}
+	return c.Redirect(http.StatusFound, app.AuthorizeURL(oh.callbackURL, state.State))
+}
+
+type CallbackQuery struct {
+	Code             string `query:"code"`
+	State            string `query:"state"`
+	Error            string `query:"error"`
+	ErrorDescription string `query:"error_description"`
+}
+
+func (oh *OAuthHandler) CallbackHandler(c echo.Context) error {
+	cq := new(CallbackQuery)
+	err := c.Bind(cq)
+	if err != nil {
+		return err
+	}
+	state, err := oh.tokenService.TakeOAuthState(c)
+	if err != nil || state.State != cq.State {
+		return echo.NewHTTPError(http.StatusBadRequest, services.ErrOAuthState.Error())
+	}
+	if cq.Error != "" {
+		// e.g. the user declined to authorize the app
+		return echo.NewHTTPError(http.StatusBadRequest, cq.ErrorDescription)
+	}
+	app, err := oh.oauthApp(state.Token)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	accessToken, err := app.Exchange(cq.Code, oh.callbackURL)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadGateway, err.Error())
+	}
+	token := state.Token
+	token.PersonalAccess = accessToken
+	token.OAuth = true
+	err = oh.tokenService.StoreToken(c, token)
+	if err != nil {
+		return err
+	}
+	return c.Redirect(http.StatusFound, "/")
+}
+
+// oauthApp is the OAuth App token's side signs in with, resolving its source kind and instance.
+func (oh *OAuthHandler) oauthApp(token services.Token) (*services.OAuthApp, error) {
+	app := oh.target.OAuth
+	if token.Type == services.Source {
+		provider, err := oh.sourceService.Provider(token.SourceKind, token.SourceInstance)
+		if err != nil {
+			return nil, err
+		}
+		app = provider.OAuth()
+	}
+	if app == nil {
+		return nil, services.ErrOAuthNotConfigured
+	}
+	return app, nil
+}
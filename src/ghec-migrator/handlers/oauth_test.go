@@ -0,0 +1,46 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/bradshjg/ghec-migrator/services"
+	"github.com/gorilla/securecookie"
+	"github.com/gorilla/sessions"
+	"github.com/labstack/echo/v4"
+)
+
+func TestAuthorizeHandler(t *testing.T) {
+	tokens := services.NewTokenService(sessions.NewCookieStore(securecookie.GenerateRandomKey(32)))
+	target := services.GitHubTarget{OAuth: &services.OAuthApp{ClientID: "client"}}
+	oh := NewOAuthHandler(tokens, nil, target, "https://migrator.example.com/")
+
+	authorize := func(query url.Values) (*httptest.ResponseRecorder, error) {
+		req := httptest.NewRequest(http.MethodGet, "/oauth/authorize?"+query.Encode(), nil)
+		req.Host = "attacker.example.com"
+		rec := httptest.NewRecorder()
+		return rec, oh.AuthorizeHandler(echo.New().NewContext(req, rec))
+	}
+
+	rec, err := authorize(url.Values{"client": {"target"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	location, err := url.Parse(rec.Header().Get(echo.HeaderLocation))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the Host header doesn't decide where the sign-in comes back to
+	if got := location.Query().Get("redirect_uri"); got != "https://migrator.example.com/oauth/callback" {
+		t.Errorf("got redirect_uri %q", got)
+	}
+
+	_, err = authorize(url.Values{"client": {"oauth-state"}})
+	var httpErr *echo.HTTPError
+	if !errors.As(err, &httpErr) || httpErr.Code != http.StatusBadRequest {
+		t.Errorf("got %v, want a 400 for an invalid client", err)
+	}
+}
@@ -0,0 +1,80 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/bradshjg/ghec-migrator/services"
+	"github.com/bradshjg/ghec-migrator/views"
+	"github.com/labstack/echo/v4"
+)
+
+func NewRunsHandler(runStore services.RunStore) *RunsHandler {
+	return &RunsHandler{
+		runStore: runStore,
+	}
+}
+
+type RunsHandler struct {
+	runStore services.RunStore
+}
+
+func (rh *RunsHandler) RunsHandler(c echo.Context) error {
+	runs, err := rh.runStore.Runs()
+	if err != nil {
+		return err
+	}
+	data := views.RunsData{
+		Runs: runs,
+	}
+	return renderView(c, views.Runs(data))
+}
+
+func (rh *RunsHandler) RunDetailHandler(c echo.Context) error {
+	run, err := rh.runStore.Run(c.Param("id"))
+	if errors.Is(err, services.ErrRunNotFound) {
+		return echo.NewHTTPError(http.StatusNotFound, err.Error())
+	}
+	if err != nil {
+		return err
+	}
+	runs, err := rh.runStore.Runs()
+	if err != nil {
+		return err
+	}
+	var retries []services.RunRecord
+	for _, r := range runs {
+		if r.RetryOf == run.ID {
+			retries = append(retries, r)
+		}
+	}
+	// the output of a single repo's migration, if one was picked from the status grid
+	repo := c.QueryParam("repo")
+	if repo != "" {
+		run.Output = services.RepoOutput(run.Output, repo)
+	}
+	data := views.RunDetailData{
+		Run:     run,
+		Retries: retries,
+		Repo:    repo,
+	}
+	return renderView(c, views.RunDetail(data))
+}
+
+func (rh *RunsHandler) RunStatusHandler(c echo.Context) error {
+	run, err := rh.runStore.Run(c.Param("id"))
+	if errors.Is(err, services.ErrRunNotFound) {
+		return echo.NewHTTPError(http.StatusNotFound, err.Error())
+	}
+	if err != nil {
+		return err
+	}
+	if run.Finished() {
+		c.Response().Writer.WriteHeader(StopPollingStatus) // HTMX handles the semantics here
+	}
+	data := views.RepoStatusData{
+		RunID: run.ID,
+		Repos: run.Repos,
+	}
+	return renderView(c, views.RepoStatusGrid(data))
+}
@@ -7,19 +7,31 @@ import (
 	"github.com/labstack/echo/v4"
 )
 
-func NewTokenHandler(tokenService services.TokenService) *TokenHandler {
+func NewTokenHandler(tokenService services.TokenService, sourceService services.SourceService, target services.GitHubTarget) *TokenHandler {
 	return &TokenHandler{
-		tokenService: tokenService,
+		tokenService:  tokenService,
+		sourceService: sourceService,
+		target:        target,
 	}
 }
 
 type TokenHandler struct {
-	tokenService services.TokenService
+	tokenService  services.TokenService
+	sourceService services.SourceService
+	target        services.GitHubTarget
 }
 
 type TokenPayload struct {
 	Token      string              `form:"token"`
 	ClientType services.ClientType `form:"client"`
+	// SourceKind, SourceInstance and Username are only set for source tokens
+	SourceKind     services.SourceKind `form:"source"`
+	SourceInstance string              `form:"instance"`
+	Username       string              `form:"username"`
+	// App authenticates as the side's GitHub App instead of with Token, either for the user signed in with the side's
+	// OAuth App or with the app's AdminSecret
+	App         bool   `form:"app"`
+	AdminSecret string `form:"admin-secret"`
 }
 
 func (th *TokenHandler) TokenHandler(c echo.Context) error {
@@ -28,9 +40,43 @@ func (th *TokenHandler) TokenHandler(c echo.Context) error {
 	if err != nil {
 		return err
 	}
+	if err := tp.ClientType.Validate(); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
 	token := services.Token{
 		PersonalAccess: tp.Token,
 		Type:           tp.ClientType,
+		App:            tp.App,
+	}
+	app := th.target.App
+	if tp.ClientType == services.Source {
+		provider, err := th.sourceService.Provider(tp.SourceKind, tp.SourceInstance)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+		}
+		token.SourceKind = provider.Kind()
+		token.SourceInstance = provider.Instance()
+		token.Username = tp.Username
+		app = provider.App()
+	}
+	if token.App {
+		if app == nil {
+			return echo.NewHTTPError(http.StatusBadRequest, services.ErrAppNotConfigured.Error())
+		}
+		token.PersonalAccess = ""
+		token.Admin = app.Admin(tp.AdminSecret)
+		if !token.Admin {
+			// anyone can reach this form, so the app is only for whoever signed in to this side (and only on their orgs)
+			signedIn, err := th.tokenService.Token(c, tp.ClientType)
+			identity := signedIn.Identity // already using the app
+			if signedIn.OAuth {
+				identity = signedIn.PersonalAccess
+			}
+			if err != nil || identity == "" || signedIn.SourceKind != token.SourceKind || signedIn.SourceInstance != token.SourceInstance {
+				return echo.NewHTTPError(http.StatusBadRequest, services.ErrAppUnauthenticated.Error())
+			}
+			token.Identity = identity
+		}
 	}
 	err = th.tokenService.StoreToken(c, token)
 	if err != nil {
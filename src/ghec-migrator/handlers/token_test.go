@@ -0,0 +1,126 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/bradshjg/ghec-migrator/services"
+	"github.com/gorilla/securecookie"
+	"github.com/gorilla/sessions"
+	"github.com/labstack/echo/v4"
+)
+
+type tokenHandlerTest struct {
+	handler *TokenHandler
+	tokens  services.TokenService
+	cookies []*http.Cookie // the browser's session
+}
+
+func newTokenHandlerTest(adminSecret string) *tokenHandlerTest {
+	tokens := services.NewTokenService(sessions.NewCookieStore(securecookie.GenerateRandomKey(32)))
+	target := services.GitHubTarget{App: &services.GitHubApp{ID: 1, AdminSecret: adminSecret}}
+	return &tokenHandlerTest{
+		handler: NewTokenHandler(tokens, nil, target),
+		tokens:  tokens,
+	}
+}
+
+func (tt *tokenHandlerTest) context(form url.Values) (echo.Context, *httptest.ResponseRecorder) {
+	req := httptest.NewRequest(http.MethodPost, "/token", strings.NewReader(form.Encode()))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationForm)
+	for _, cookie := range tt.cookies {
+		req.AddCookie(cookie)
+	}
+	rec := httptest.NewRecorder()
+	return echo.New().NewContext(req, rec), rec
+}
+
+// post submits the token form, keeping the session it sets.
+func (tt *tokenHandlerTest) post(form url.Values) error {
+	c, rec := tt.context(form)
+	err := tt.handler.TokenHandler(c)
+	if cookies := rec.Result().Cookies(); len(cookies) != 0 {
+		tt.cookies = cookies
+	}
+	return err
+}
+
+// signIn stores a token as if the user had signed in with the target's OAuth App.
+func (tt *tokenHandlerTest) signIn(t *testing.T, accessToken string) {
+	t.Helper()
+	c, rec := tt.context(nil)
+	if err := tt.tokens.StoreToken(c, services.Token{PersonalAccess: accessToken, OAuth: true, Type: services.Target}); err != nil {
+		t.Fatal(err)
+	}
+	tt.cookies = rec.Result().Cookies()
+}
+
+func (tt *tokenHandlerTest) token(t *testing.T) (services.Token, error) {
+	t.Helper()
+	c, _ := tt.context(nil)
+	return tt.tokens.Token(c, services.Target)
+}
+
+func TestTokenHandlerRejectsAnonymousApp(t *testing.T) {
+	tt := newTokenHandlerTest("admin-secret")
+
+	err := tt.post(url.Values{"client": {"target"}, "app": {"true"}})
+	var httpErr *echo.HTTPError
+	if !errors.As(err, &httpErr) || httpErr.Code != http.StatusBadRequest {
+		t.Fatalf("got %v, want a 400", err)
+	}
+	if _, err := tt.token(t); !errors.Is(err, services.ErrTokenNotFound) {
+		t.Errorf("got %v, want no token stored", err)
+	}
+
+	// a pasted PAT doesn't say who's asking either, only an OAuth sign-in does
+	if err := tt.post(url.Values{"client": {"target"}, "token": {"ghp_pasted"}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := tt.post(url.Values{"client": {"target"}, "app": {"true"}, "admin-secret": {"wrong"}}); !errors.As(err, &httpErr) || httpErr.Code != http.StatusBadRequest {
+		t.Errorf("got %v, want a 400", err)
+	}
+}
+
+func TestTokenHandlerAppForSignedInUser(t *testing.T) {
+	tt := newTokenHandlerTest("")
+	tt.signIn(t, "gho_user")
+
+	if err := tt.post(url.Values{"client": {"target"}, "app": {"true"}}); err != nil {
+		t.Fatal(err)
+	}
+	token, err := tt.token(t)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !token.App || token.Admin || token.Identity != "gho_user" || token.PersonalAccess != "" {
+		t.Errorf("got %+v, want an app token vouched for by the signed-in user", token)
+	}
+
+	// choosing the app again keeps who it's for
+	if err := tt.post(url.Values{"client": {"target"}, "app": {"true"}}); err != nil {
+		t.Fatal(err)
+	}
+	if token, _ := tt.token(t); token.Identity != "gho_user" {
+		t.Errorf("got %+v, want the signed-in user kept", token)
+	}
+}
+
+func TestTokenHandlerAppWithAdminSecret(t *testing.T) {
+	tt := newTokenHandlerTest("admin-secret")
+
+	if err := tt.post(url.Values{"client": {"target"}, "app": {"true"}, "admin-secret": {"admin-secret"}}); err != nil {
+		t.Fatal(err)
+	}
+	token, err := tt.token(t)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !token.App || !token.Admin {
+		t.Errorf("got %+v, want an admin app token", token)
+	}
+}
@@ -1,7 +1,13 @@
 package main
 
 import (
+	"fmt"
+	"log"
+	"net/url"
 	"os"
+	"regexp"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/bradshjg/ghec-migrator/handlers"
@@ -30,23 +36,206 @@ func main() {
 
 	e.Static("/static", "assets")
 
+	// demo mode simulates GitHub and gh gei so the whole UI can be tried offline
+	demo := os.Getenv("DEMO") == "true"
+
+	runStorePath := os.Getenv("RUN_STORE_PATH")
+	if runStorePath == "" {
+		runStorePath = "ghec-migrator.db"
+		if demo {
+			runStorePath = "ghec-migrator-demo.db"
+		}
+	}
+	rs, err := services.NewRunStore(runStorePath, sessionStore.Codecs...)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// the target is GitHub.com unless GHE_COM_TARGET_URL names a GHE.com data-residency tenant
+	target, err := services.NewGitHubTarget(os.Getenv("GHE_COM_TARGET_URL"))
+	if err != nil {
+		log.Fatal(err)
+	}
+	if !demo {
+		target.App, err = gitHubApp("GITHUB_TARGET_APP", target.APIURL())
+		if err != nil {
+			log.Fatal(err)
+		}
+		target.OAuth = oauthApp("GITHUB_TARGET_OAUTH", target.URL)
+	}
+	oauthConfigured := target.OAuth != nil
+
 	ts := services.NewTokenService(sessionStore)
-	gs := services.NewGitHubService(ts)
-	ms := services.NewMigratorService(gs)
+	var gs services.GitHubService = services.NewGitHubService(ts, target)
+	var executor services.Executor = services.NewGHExecutor()
+	if demo {
+		gs = services.NewDemoGitHubService(ts)
+		executor = services.NewDemoExecutor()
+	}
+	// several GitHub Enterprise Server instances can be named in GITHUB_ENTERPRISE_SOURCES, otherwise there's the one
+	// in GITHUB_ENTERPRISE_SOURCE_URL, or GitHub.com
+	githubInstances := []services.GitHubInstance{{URL: os.Getenv("GITHUB_ENTERPRISE_SOURCE_URL")}}
+	if list := os.Getenv("GITHUB_ENTERPRISE_SOURCES"); list != "" && !demo {
+		githubInstances, err = services.ParseGitHubInstances(list)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+	var sources []services.SourceProvider
+	for _, instance := range githubInstances {
+		if !demo {
+			// e.g. GITHUB_SOURCE_APP_ID, or GITHUB_SOURCE_APP_<NAME>_ID for a named instance
+			var suffix string
+			if instance.Name != "" {
+				suffix = "_" + envSuffix(instance.Name)
+			}
+			instance.App, err = gitHubApp("GITHUB_SOURCE_APP"+suffix, instance.URL)
+			if err != nil {
+				log.Fatal(err)
+			}
+			instance.OAuth = oauthApp("GITHUB_SOURCE_OAUTH"+suffix, instance.URL)
+			oauthConfigured = oauthConfigured || instance.OAuth != nil
+		}
+		sources = append(sources, services.NewGitHubSource(gs, instance))
+	}
+	if !demo {
+		sources = append(sources, services.NewAzureDevOpsSource())
+		if bbsServerURL := os.Getenv("BBS_SERVER_URL"); bbsServerURL != "" {
+			bbs := services.NewBitbucketServerSource(bbsServerURL)
+			bbs.SSHUser = os.Getenv("BBS_SSH_USER")
+			bbs.SSHPrivateKeyFile, err = bbsSSHPrivateKeyFile()
+			if err != nil {
+				log.Fatal(err)
+			}
+			sources = append(sources, bbs)
+		}
+	}
+	ss := services.NewSourceService(ts, sources...)
+	// OAuth sign-ins are sent back to BASE_URL, the URL users reach the server at
+	baseURL := os.Getenv("BASE_URL")
+	if oauthConfigured {
+		if err := validBaseURL(baseURL); err != nil {
+			log.Fatal(err)
+		}
+	}
+	workers, err := strconv.Atoi(os.Getenv("MIGRATION_WORKERS"))
+	if err != nil {
+		workers = 1
+	}
+	concurrency, err := strconv.Atoi(os.Getenv("MIGRATION_CONCURRENCY"))
+	if err != nil {
+		concurrency = 5
+	}
+	ms := services.NewMigratorService(gs, ss, target, rs, executor, workers, concurrency)
 
-	th := handlers.NewTokenHandler(ts)
-	gh := handlers.NewGitHubHandler(gs)
-	mh := handlers.NewMigratorHandler(ms)
+	th := handlers.NewTokenHandler(ts, ss, target)
+	oh := handlers.NewOAuthHandler(ts, ss, target, baseURL)
+	gh := handlers.NewGitHubHandler(gs, ss)
+	mh := handlers.NewMigratorHandler(ms, ss, target)
+	rh := handlers.NewRunsHandler(rs)
+	mrh := handlers.NewMigratorRoleHandler(services.NewMigratorRoleService(gs, target, rs, executor), gs)
+	mqh := handlers.NewMannequinHandler(services.NewMannequinService(gs, target, rs, executor), gs)
 
 	e.GET("/", mh.IndexHandler)
 	e.POST("/run", mh.StartRunHandler)
 	e.GET("/run", mh.RunHandler)
+	e.POST("/readiness", mh.ReadinessHandler)
+	e.GET("/readiness/:id", mh.ReadinessCheckHandler)
 	e.GET("/output", mh.OutputHandler)
+	e.GET("/queue", mh.QueueHandler)
+	e.POST("/cancel", mh.CancelHandler)
+	e.GET("/runs", rh.RunsHandler)
+	e.GET("/runs/:id", rh.RunDetailHandler)
+	e.GET("/runs/:id/status", rh.RunStatusHandler)
+	e.POST("/runs/:id/retry", mh.RetryHandler)
+	e.POST("/runs/:id/schedule", mh.RescheduleHandler)
+	e.GET("/migrators", mrh.MigratorRolesHandler)
+	e.POST("/migrators", mrh.ChangeMigratorRoleHandler)
+	e.GET("/mannequins", mqh.MannequinsHandler)
+	e.POST("/mannequins", mqh.ReclaimHandler)
+	e.GET("/mannequins/csv", mqh.DownloadCSVHandler)
+	e.POST("/mannequins/csv", mqh.UploadCSVHandler)
 	e.POST("/token", th.TokenHandler)
 	e.POST("/tokens/reset", th.ResetTokensHandler)
+	e.GET("/oauth/authorize", oh.AuthorizeHandler)
+	e.GET("/oauth/callback", oh.CallbackHandler)
 	e.GET("/orgs", gh.OrgsHandler)
 	e.GET("/repos", gh.ReposHandler)
+	e.GET("/permissions", gh.PermissionsHandler)
 	e.GET("/*", handlers.RouteNotFoundHandler)
 
 	e.Logger.Fatal(e.Start(":8080"))
 }
+
+// gitHubApp loads the GitHub App configured by PREFIX_ID, PREFIX_PRIVATE_KEY_FILE and optionally PREFIX_ADMIN_SECRET,
+// nil if there's none.
+func gitHubApp(prefix string, apiURL string) (*services.GitHubApp, error) {
+	id := os.Getenv(prefix + "_ID")
+	if id == "" {
+		return nil, nil
+	}
+	appID, err := strconv.ParseInt(id, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s_ID %q: %w", prefix, id, err)
+	}
+	privateKey, err := os.ReadFile(os.Getenv(prefix + "_PRIVATE_KEY_FILE"))
+	if err != nil {
+		return nil, fmt.Errorf("error reading %s_PRIVATE_KEY_FILE: %w", prefix, err)
+	}
+	app, err := services.NewGitHubApp(appID, privateKey, apiURL)
+	if err != nil {
+		return nil, err
+	}
+	app.AdminSecret = os.Getenv(prefix + "_ADMIN_SECRET")
+	return app, nil
+}
+
+// validBaseURL checks BASE_URL is an absolute http(s) URL, which OAuth Apps' callback URLs are under.
+func validBaseURL(baseURL string) error {
+	u, err := url.Parse(baseURL)
+	if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" || u.RawQuery != "" || u.Fragment != "" {
+		return fmt.Errorf("invalid BASE_URL %q, signing in with an OAuth App needs the URL users reach the server at, e.g. https://migrator.example.com", baseURL)
+	}
+	return nil
+}
+
+// oauthApp is the OAuth App configured by PREFIX_CLIENT_ID and PREFIX_CLIENT_SECRET, nil if there's none.
+func oauthApp(prefix string, url string) *services.OAuthApp {
+	clientID := os.Getenv(prefix + "_CLIENT_ID")
+	if clientID == "" {
+		return nil
+	}
+	return &services.OAuthApp{
+		ClientID:     clientID,
+		ClientSecret: os.Getenv(prefix + "_CLIENT_SECRET"),
+		URL:          url,
+	}
+}
+
+// bbsSSHPrivateKeyFile is the path of the SSH private key in BBS_SSH_PRIVATE_KEY_FILE, or of a file only this user
+// can read holding the key in BBS_SSH_PRIVATE_KEY, empty if there's neither.
+func bbsSSHPrivateKeyFile() (string, error) {
+	if path := os.Getenv("BBS_SSH_PRIVATE_KEY_FILE"); path != "" {
+		return path, nil
+	}
+	key := os.Getenv("BBS_SSH_PRIVATE_KEY")
+	if key == "" {
+		return "", nil
+	}
+	f, err := os.CreateTemp("", "bbs-ssh-key-")
+	if err != nil {
+		return "", fmt.Errorf("error writing BBS_SSH_PRIVATE_KEY to a file: %w", err)
+	}
+	defer f.Close()
+	if _, err := f.WriteString(key); err != nil {
+		return "", fmt.Errorf("error writing BBS_SSH_PRIVATE_KEY to a file: %w", err)
+	}
+	return f.Name(), nil
+}
+
+var nonAlphanumeric = regexp.MustCompile(`[^A-Z0-9]+`)
+
+// envSuffix turns an instance name into something environment variable names can end with, ghes-west becoming GHES_WEST.
+func envSuffix(name string) string {
+	return nonAlphanumeric.ReplaceAllString(strings.ToUpper(name), "_")
+}
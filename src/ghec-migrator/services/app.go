@@ -0,0 +1,179 @@
+package services
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/subtle"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/go-github/v74/github"
+)
+
+var (
+	// ErrAppNotConfigured is returned when a token or run relies on a GitHub App the server no longer has.
+	ErrAppNotConfigured = errors.New("GitHub App is not configured")
+	// ErrAppUnauthenticated is returned when authenticating as a GitHub App without first proving who's asking.
+	ErrAppUnauthenticated = errors.New("sign in with OAuth, or enter the app's admin secret, to use the GitHub App")
+)
+
+// installationTokenMargin is how long before it expires an installation token is replaced, so a token handed to a
+// command or API call doesn't expire while it's used.
+const installationTokenMargin = 10 * time.Minute
+
+// NewGitHubApp loads a GitHub App's PEM private key. apiURL is the API of the GitHub Enterprise Server or GHE.com
+// tenant the app is registered on, empty for GitHub.com.
+func NewGitHubApp(id int64, privateKey []byte, apiURL string) (*GitHubApp, error) {
+	block, _ := pem.Decode(privateKey)
+	if block == nil {
+		return nil, fmt.Errorf("error loading GitHub App %d private key: no PEM data", id)
+	}
+	// GitHub generates PKCS #1 keys, but a key converted to PKCS #8 is just as good
+	key, err := x509.ParsePKCS1PrivateKey(block.Bytes)
+	if err != nil {
+		pkcs8Key, pkcs8Err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		rsaKey, ok := pkcs8Key.(*rsa.PrivateKey)
+		if pkcs8Err != nil || !ok {
+			return nil, fmt.Errorf("error loading GitHub App %d private key: %w", id, err)
+		}
+		key = rsaKey
+	}
+	return &GitHubApp{
+		ID:     id,
+		key:    key,
+		apiURL: apiURL,
+		tokens: map[string]*github.InstallationToken{},
+	}, nil
+}
+
+// GitHubApp authenticates as a GitHub App installed on the orgs being migrated, instead of as whoever pasted a PAT.
+// Installation tokens are short-lived, so they're minted per org when needed and cached until shortly before they expire.
+type GitHubApp struct {
+	ID     int64
+	key    *rsa.PrivateKey
+	apiURL string
+
+	// AdminSecret, if set, lets whoever knows it use the app without signing in first. Otherwise only users signed in
+	// with the side's OAuth App can, and only on orgs they own.
+	AdminSecret string
+
+	mu     sync.Mutex
+	tokens map[string]*github.InstallationToken // by org
+}
+
+// Admin reports whether secret is the app's admin secret.
+func (a *GitHubApp) Admin(secret string) bool {
+	return a.AdminSecret != "" && subtle.ConstantTimeCompare([]byte(secret), []byte(a.AdminSecret)) == 1
+}
+
+// Validate checks the app exists and the private key is its own.
+func (a *GitHubApp) Validate() error {
+	client, err := a.appClient()
+	if err != nil {
+		return err
+	}
+	if _, _, err := client.Apps.Get(context.Background(), ""); err != nil {
+		return fmt.Errorf("error authenticating as GitHub App %d: %w", a.ID, err)
+	}
+	return nil
+}
+
+// Orgs lists the orgs the app is installed on.
+func (a *GitHubApp) Orgs() ([]string, error) {
+	ctx := context.Background()
+	client, err := a.appClient()
+	if err != nil {
+		return []string{}, err
+	}
+	opt := &github.ListOptions{
+		PerPage: 100,
+	}
+	var allOrgs []string
+	for {
+		installations, resp, err := client.Apps.ListInstallations(ctx, opt)
+		if err != nil {
+			return []string{}, fmt.Errorf("error listing GitHub App installations: %w", err)
+		}
+		for _, installation := range installations {
+			if installation.GetAccount().GetType() == "Organization" {
+				allOrgs = append(allOrgs, installation.GetAccount().GetLogin())
+			}
+		}
+		if resp.NextPage == 0 {
+			break
+		}
+		opt.Page = resp.NextPage
+	}
+	return allOrgs, nil
+}
+
+// InstallationToken returns a token for the app's installation on org, valid for at least installationTokenMargin.
+func (a *GitHubApp) InstallationToken(org string) (string, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if token, ok := a.tokens[org]; ok && time.Until(token.GetExpiresAt().Time) > installationTokenMargin {
+		return token.GetToken(), nil
+	}
+	ctx := context.Background()
+	client, err := a.appClient()
+	if err != nil {
+		return "", err
+	}
+	installation, _, err := client.Apps.FindOrganizationInstallation(ctx, org)
+	if err != nil {
+		return "", fmt.Errorf("error finding GitHub App installation on %s: %w", org, err)
+	}
+	token, _, err := client.Apps.CreateInstallationToken(ctx, installation.GetID(), nil)
+	if err != nil {
+		return "", fmt.Errorf("error creating installation token for %s: %w", org, err)
+	}
+	a.tokens[org] = token
+	return token.GetToken(), nil
+}
+
+// appClient authenticates as the app itself, which is only good for managing its installations.
+func (a *GitHubApp) appClient() (*github.Client, error) {
+	jwt, err := a.jwt()
+	if err != nil {
+		return nil, err
+	}
+	client := github.NewClient(nil).WithAuthToken(jwt)
+	if a.apiURL != "" {
+		return client.WithEnterpriseURLs(a.apiURL, a.apiURL)
+	}
+	return client, nil
+}
+
+// jwt signs the short-lived JWT GitHub Apps authenticate with. It's backdated a minute to allow for clock drift.
+func (a *GitHubApp) jwt() (string, error) {
+	now := time.Now()
+	header, err := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT"})
+	if err != nil {
+		return "", err
+	}
+	claims, err := json.Marshal(map[string]any{
+		"iat": now.Add(-time.Minute).Unix(),
+		"exp": now.Add(9 * time.Minute).Unix(),
+		"iss": fmt.Sprint(a.ID),
+	})
+	if err != nil {
+		return "", err
+	}
+	unsigned := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(claims)
+	digest := sha256.Sum256([]byte(unsigned))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, a.key, crypto.SHA256, digest[:])
+	if err != nil {
+		return "", fmt.Errorf("error signing GitHub App JWT: %w", err)
+	}
+	return strings.Join([]string{unsigned, base64.RawURLEncoding.EncodeToString(signature)}, "."), nil
+}
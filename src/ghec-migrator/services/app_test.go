@@ -0,0 +1,149 @@
+package services
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// testApp is a GitHub App 42 installed on source-org and target-org of a fake GitHub API that checks its JWTs.
+type testApp struct {
+	*GitHubApp
+	minted atomic.Int32 // installation tokens created
+	// lifetime of the installation tokens it mints, an hour if zero
+	lifetime atomic.Int64
+}
+
+func newTestApp(t *testing.T) *testApp {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	app := &testApp{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := verifyAppJWT(&key.PublicKey, strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")); err != nil {
+			t.Errorf("%s %s: %v", r.Method, r.URL.Path, err)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		var resp any
+		switch path := strings.TrimPrefix(r.URL.Path, "/api/v3"); {
+		case path == "/app":
+			resp = map[string]any{"id": 42}
+		case path == "/app/installations":
+			resp = []map[string]any{
+				{"id": 1, "account": map[string]any{"login": "source-org", "type": "Organization"}},
+				{"id": 2, "account": map[string]any{"login": "target-org", "type": "Organization"}},
+				{"id": 3, "account": map[string]any{"login": "octocat", "type": "User"}},
+			}
+		case path == "/orgs/source-org/installation":
+			resp = map[string]any{"id": 1}
+		case path == "/orgs/target-org/installation":
+			resp = map[string]any{"id": 2}
+		case strings.HasPrefix(path, "/app/installations/") && strings.HasSuffix(path, "/access_tokens") && r.Method == http.MethodPost:
+			n := app.minted.Add(1)
+			lifetime := time.Duration(app.lifetime.Load())
+			if lifetime == 0 {
+				lifetime = time.Hour
+			}
+			w.WriteHeader(http.StatusCreated)
+			resp = map[string]any{
+				"token":      fmt.Sprintf("ghs_%s_%d", strings.Split(path, "/")[3], n),
+				"expires_at": time.Now().Add(lifetime).Format(time.RFC3339),
+			}
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		json.NewEncoder(w).Encode(resp)
+	}))
+	t.Cleanup(server.Close)
+	privateKey := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+	app.GitHubApp, err = NewGitHubApp(42, privateKey, server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return app
+}
+
+func verifyAppJWT(key *rsa.PublicKey, jwt string) error {
+	parts := strings.Split(jwt, ".")
+	if len(parts) != 3 {
+		return fmt.Errorf("malformed JWT %q", jwt)
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return err
+	}
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	if err := rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], signature); err != nil {
+		return err
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return err
+	}
+	var claims struct {
+		Iss string
+		Iat int64
+		Exp int64
+	}
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return err
+	}
+	if now := time.Now().Unix(); claims.Iss != "42" || claims.Iat > now || claims.Exp < now || claims.Exp-claims.Iat > 600 {
+		return fmt.Errorf("unexpected claims %+v", claims)
+	}
+	return nil
+}
+
+func TestGitHubApp(t *testing.T) {
+	app := newTestApp(t)
+
+	if err := app.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	orgs, err := app.Orgs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"source-org", "target-org"}; !slices.Equal(orgs, want) {
+		t.Errorf("got orgs %v, want %v", orgs, want)
+	}
+	token, err := app.InstallationToken("target-org")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token != "ghs_2_1" {
+		t.Errorf("got token %q", token)
+	}
+	// cached while it has time left
+	if token, _ := app.InstallationToken("target-org"); token != "ghs_2_1" || app.minted.Load() != 1 {
+		t.Errorf("got token %q after minting %d", token, app.minted.Load())
+	}
+	// and replaced before it expires
+	app.tokens["target-org"].ExpiresAt.Time = time.Now().Add(installationTokenMargin / 2)
+	if token, _ := app.InstallationToken("target-org"); token != "ghs_2_2" {
+		t.Errorf("got token %q, want a new one", token)
+	}
+}
+
+func TestNewGitHubAppInvalidKey(t *testing.T) {
+	if _, err := NewGitHubApp(42, []byte("not a key"), ""); err == nil {
+		t.Error("got no error for a malformed key")
+	}
+}
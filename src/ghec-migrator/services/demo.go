@@ -0,0 +1,175 @@
+package services
+
+import (
+	"errors"
+	"slices"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// demoOrgs are the orgs (and their repos) the demo pretends each side has.
+var demoOrgs = map[ClientType]map[string][]string{
+	Source: {
+		"acme-platform": {"api-gateway", "auth-service", "billing", "design-system", "infra-terraform", "legacy-monolith", "mobile-app", "web-frontend"},
+		"acme-data":     {"data-lake", "etl-jobs", "ml-models", "reporting"},
+	},
+	Target: {
+		"acme-cloud":   {},
+		"acme-sandbox": {"hello-world", "reporting"},
+	},
+}
+
+// demoMannequins are the mannequins the demo's earlier migrations left in every target org, and demoMembers the org
+// members they can be reclaimed by: jdoe matches by login, msmith by email, rlee as a managed user and one is claimed.
+var (
+	demoMannequins = []Mannequin{
+		{ID: "MDg6TWFubmVxdWluMQ==", Login: "jdoe", Email: "jdoe@acme.example"},
+		{ID: "MDg6TWFubmVxdWluMg==", Login: "m-smith", Email: "maria.smith@acme.example"},
+		{ID: "MDg6TWFubmVxdWluMw==", Login: "rlee"},
+		{ID: "MDg6TWFubmVxdWluNA==", Login: "build-bot"},
+		{ID: "MDg6TWFubmVxdWluNQ==", Login: "akumar", Claimant: "akumar_acme"},
+	}
+	demoMembers = []OrgMember{
+		{Login: "jdoe"},
+		{Login: "maria-smith", Email: "maria.smith@acme.example"},
+		{Login: "rlee_acme"},
+		{Login: "akumar_acme"},
+	}
+)
+
+// demoRepoFacts give some of the demo's source repos something for the readiness checks to warn about. legacy-monolith
+// has too many files to check them all, so its large files are only found once it's migrated. What blocks a run is
+// acme-sandbox already having a reporting repo.
+var demoRepoFacts = map[string]RepoFacts{
+	"data-lake":       {Size: 14 << 30, LargestObject: "snapshots/2023.parquet", LargestObjectSize: 160 << 20},
+	"design-system":   {Size: 900 << 20, UsesLFS: true, OpenPullRequests: 3},
+	"infra-terraform": {Size: 40 << 20, Archived: true},
+	"legacy-monolith": {Size: 31 << 30, ObjectsTruncated: true, OpenPullRequests: 12},
+	"ml-models":       {Size: 6 << 30, LargestObject: "weights/resnet.bin", LargestObjectSize: 240 << 20, UsesLFS: true},
+}
+
+// demoStep is how long each simulated GEI status poll takes (GEI itself waits 10 seconds between polls).
+const demoStep = 2 * time.Second
+
+// NewDemoExecutor simulates gh with plausible GEI output. Most repos take a few polls to migrate, the big
+// ones take longer and legacy-monolith fails the way large repos do.
+func NewDemoExecutor() *FakeExecutor {
+	e := NewFakeExecutor(MigrationSucceeds(3, demoStep))
+	e.Scripts["legacy-monolith"] = MigrationFails(4, demoStep, "Repository legacy-monolith has 3 files larger than 2 GiB (the largest is assets/video/intro.mov), which exceeds the GitHub repository limit.")
+	e.Scripts["data-lake"] = MigrationSucceeds(12, demoStep)
+	e.Scripts["ml-models"] = MigrationSucceeds(8, demoStep)
+	e.Scripts["grant-migrator-role"] = MigratorRoleChanged(false)
+	e.Scripts["revoke-migrator-role"] = MigratorRoleChanged(true)
+	e.Scripts["reclaim-mannequin"] = MannequinReclaimed()
+	e.Scripts[CodeScanningAlertsStep.Command] = AlertsMigrated(CodeScanningAlertsStep)
+	e.Scripts[SecretAlertsStep.Command] = AlertsMigrated(SecretAlertsStep)
+	e.Scripts[SecretAlertsStep.Command+" billing"] = FakeScript{
+		Lines: []FakeLine{
+			{demoStep, "[INFO] Migrating secret scanning alerts from {source-org}/{repo} to {target-org}/{target-repo}..."},
+			{0, "[ERROR] Secret scanning is not enabled for {target-org}/{target-repo}"},
+		},
+		ExitCode: 1,
+	}
+	return e
+}
+
+func NewDemoGitHubService(tokenService TokenService) *DemoGitHubService {
+	return &DemoGitHubService{
+		tokenService: tokenService,
+	}
+}
+
+// DemoGitHubService stands in for the GitHub API with fixture orgs and repos. Any token is accepted, and
+// every repository migration the tracker asks about has succeeded.
+type DemoGitHubService struct {
+	tokenService TokenService
+}
+
+func (gs *DemoGitHubService) Token(c echo.Context, t ClientType) (Token, error) {
+	return gs.tokenService.Token(c, t)
+}
+
+func (gs *DemoGitHubService) Orgs(c echo.Context, t ClientType) ([]string, error) {
+	return demoOrgNames(t), nil
+}
+
+func (gs *DemoGitHubService) SourceOrgs(sourceURL string, sourceToken string) ([]string, error) {
+	return demoOrgNames(Source), nil
+}
+
+func (gs *DemoGitHubService) OrgRepos(sourceURL string, sourceToken string, org string) ([]string, error) {
+	return demoRepos(Source, org)
+}
+
+// Scopes grants whatever token was entered the scopes migrations need.
+func (gs *DemoGitHubService) Scopes(c echo.Context, t ClientType) ([]string, error) {
+	if _, err := gs.Token(c, t); err != nil {
+		return nil, err
+	}
+	return requiredScopes, nil
+}
+
+func (gs *DemoGitHubService) SourceScopes(sourceURL string, sourceToken string) ([]string, error) {
+	return requiredScopes, nil
+}
+
+func (gs *DemoGitHubService) OrgPermissions(c echo.Context, t ClientType, org string) error {
+	return nil
+}
+
+func (gs *DemoGitHubService) SourceOrgPermissions(sourceURL string, sourceToken string, org string) error {
+	return nil
+}
+
+func (gs *DemoGitHubService) AbortMigration(targetToken string, migrationID string) error {
+	return nil
+}
+
+func (gs *DemoGitHubService) RepositoryMigrations(targetToken string, migrationIDs []string) ([]RepositoryMigration, error) {
+	var migrations []RepositoryMigration
+	for _, id := range migrationIDs {
+		migrations = append(migrations, RepositoryMigration{ID: id, State: "SUCCEEDED"})
+	}
+	return migrations, nil
+}
+
+func (gs *DemoGitHubService) Mannequins(targetToken string, org string) ([]Mannequin, error) {
+	return slices.Clone(demoMannequins), nil
+}
+
+func (gs *DemoGitHubService) OrgMembers(targetToken string, org string) ([]OrgMember, error) {
+	return slices.Clone(demoMembers), nil
+}
+
+func (gs *DemoGitHubService) SourceRepo(sourceURL string, sourceToken string, org string, repo string) (RepoFacts, error) {
+	repos, err := demoRepos(Source, org)
+	if err != nil {
+		return RepoFacts{}, err
+	}
+	if !slices.Contains(repos, repo) {
+		return RepoFacts{}, ErrRepoNotFound
+	}
+	return demoRepoFacts[repo], nil
+}
+
+func (gs *DemoGitHubService) RepoExists(targetToken string, org string, repo string) (bool, error) {
+	return slices.Contains(demoOrgs[Target][org], repo), nil
+}
+
+func demoOrgNames(t ClientType) []string {
+	var orgs []string
+	for org := range demoOrgs[t] {
+		orgs = append(orgs, org)
+	}
+	slices.Sort(orgs)
+	return orgs
+}
+
+func demoRepos(t ClientType, org string) ([]string, error) {
+	repos, ok := demoOrgs[t][org]
+	if !ok {
+		return nil, errors.New("error listing repos: 404 Not Found")
+	}
+	return slices.Clone(repos), nil
+}
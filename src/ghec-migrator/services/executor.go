@@ -0,0 +1,189 @@
+package services
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"slices"
+	"strings"
+	"sync"
+)
+
+const ghCLICmd = "gh"
+
+// Command is a gh command a migration runs, e.g. `gh gei migrate-repo ...`.
+type Command struct {
+	Args []string // arguments to gh
+	Env  []string
+	Dir  string
+}
+
+// secretFlags are the gh extensions' flags that take a secret. Commands pass secrets in their environment instead,
+// but they're redacted from String in case one slips into the arguments.
+var secretFlags = []string{
+	"--github-source-pat",
+	"--github-target-pat",
+	"--github-pat",
+	"--ado-pat",
+	"--bbs-password",
+	"--azure-storage-connection-string",
+	"--aws-access-key",
+	"--aws-secret-key",
+	"--aws-session-token",
+}
+
+// String is the command line as shown in plans and output, with any secret values redacted.
+func (c Command) String() string {
+	args := slices.Clone(c.Args)
+	for i := 1; i < len(args); i++ {
+		if slices.Contains(secretFlags, args[i-1]) {
+			args[i] = "***"
+		}
+	}
+	return strings.Join(append([]string{ghCLICmd}, args...), " ")
+}
+
+// Process is a started Command.
+type Process interface {
+	// Output streams the lines the command writes to stdout and stderr, and is closed once both are.
+	Output() <-chan string
+	// Wait waits for the command to exit (after Output is drained) and returns its exit code, -1 if it didn't exit normally.
+	Wait() int
+	// Kill stops the command along with anything it started.
+	Kill() error
+}
+
+// Executor starts the commands migrations run.
+type Executor interface {
+	Start(cmd Command) (Process, error)
+}
+
+// targetEnv is the environment a command runs with: the server's PATH and HOME, so gh finds itself and its extensions,
+// and the target token, which GEI reads from GH_PAT.
+func targetEnv(targetToken string) []string {
+	return []string{
+		fmt.Sprintf("PATH=%s", os.Getenv("PATH")),
+		fmt.Sprintf("HOME=%s", os.Getenv("HOME")),
+		fmt.Sprintf("GH_PAT=%s", targetToken),
+	}
+}
+
+// processTracker is told about a command's process while it runs, so it can be killed.
+type processTracker interface {
+	started(p Process)
+	stopped(p Process)
+}
+
+// runCommand runs cmd to completion, handing each line of its output to record as it's printed, and returns its exit
+// code, -1 if it couldn't be started. A cmd without a working directory gets a temporary one of its own, since GEI
+// writes its log to the current one. tracker, if not nil, is told about the process.
+func runCommand(executor Executor, cmd Command, record func(line string), tracker processTracker) int {
+	if cmd.Dir == "" {
+		workDir, err := os.MkdirTemp("", "ghec-migrator-")
+		if err != nil {
+			record(fmt.Sprintf("error creating working directory: %v", err))
+			return -1
+		}
+		defer os.RemoveAll(workDir)
+		cmd.Dir = workDir
+	}
+	p, err := executor.Start(cmd)
+	if err != nil {
+		record(fmt.Sprintf("error starting %s: %v", cmd, err))
+		return -1
+	}
+	if tracker != nil {
+		tracker.started(p)
+		defer tracker.stopped(p)
+	}
+	for line := range p.Output() {
+		record(line)
+	}
+	return p.Wait()
+}
+
+func NewGHExecutor() *GHExecutor {
+	return &GHExecutor{}
+}
+
+// GHExecutor runs commands with the gh CLI on the PATH.
+type GHExecutor struct{}
+
+// Start starts cmd in its own process group, so Kill reaches the gei extension gh runs.
+func (*GHExecutor) Start(cmd Command) (Process, error) {
+	c := exec.Command(ghCLICmd, cmd.Args...)
+	c.Env = cmd.Env
+	c.Dir = cmd.Dir
+	setProcessGroup(c)
+
+	stdoutPipe, err := c.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	stderrPipe, err := c.StderrPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := c.Start(); err != nil {
+		return nil, err
+	}
+
+	p := &ghProcess{cmd: c, lines: make(chan string)}
+	var wg sync.WaitGroup
+	for _, pipe := range []io.ReadCloser{stdoutPipe, stderrPipe} {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			collectOutput(p.lines, pipe)
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(p.lines)
+	}()
+	return p, nil
+}
+
+type ghProcess struct {
+	cmd   *exec.Cmd
+	lines chan string
+}
+
+func (p *ghProcess) Output() <-chan string {
+	return p.lines
+}
+
+func (p *ghProcess) Wait() int {
+	if err := p.cmd.Wait(); err != nil {
+		log.Printf("command finished with error: %v", err)
+		return exitCodeFromErr(err)
+	}
+	return 0
+}
+
+func (p *ghProcess) Kill() error {
+	return killProcessGroup(p.cmd)
+}
+
+// exitCodeFromErr extracts the process exit code from a command error, or -1 if the process didn't exit normally.
+func exitCodeFromErr(err error) int {
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return exitErr.ExitCode()
+	}
+	return -1
+}
+
+func collectOutput(ch chan string, readPipe io.ReadCloser) {
+	scanner := bufio.NewScanner(readPipe)
+	for scanner.Scan() {
+		ch <- scanner.Text()
+	}
+	if err := scanner.Err(); err != nil {
+		log.Printf("error reading pipe: %v", err)
+	}
+}
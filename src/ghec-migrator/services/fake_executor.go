@@ -0,0 +1,263 @@
+package services
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// FakeLine is a line of fake command output, written After the previous one.
+type FakeLine struct {
+	After time.Duration
+	Text  string
+}
+
+// FakeScript is what a fake command does. Lines may refer to the command's repos, orgs, migration ID, migrator role
+// actor and mannequin as {repo}, {target-repo}, {source-org}, {target-org}, {migration-id}, {actor}, {mannequin-user}
+// and {target-user}.
+type FakeScript struct {
+	Lines    []FakeLine
+	ExitCode int
+	StartErr error // returned by Start instead of running the script
+}
+
+// MigrationSucceeds is the output of a `gh gei migrate-repo` that's polled in progress steps times, step apart, and succeeds.
+func MigrationSucceeds(steps int, step time.Duration) FakeScript {
+	return FakeScript{
+		Lines: append(migrationStarted(steps, step),
+			FakeLine{step, "[INFO] Migration completed (ID: {migration-id})! State: SUCCEEDED"},
+			FakeLine{0, "[INFO] Migration log available at https://github.com/{target-org}/{target-repo}/issues"},
+		),
+	}
+}
+
+// MigrationFails is the output of a `gh gei migrate-repo` that's polled in progress steps times, step apart, and fails with reason.
+func MigrationFails(steps int, step time.Duration, reason string) FakeScript {
+	return FakeScript{
+		Lines: append(migrationStarted(steps, step),
+			FakeLine{step, "[ERROR] Migration Failed. Migration ID: {migration-id}"},
+			FakeLine{0, "[ERROR] " + reason},
+		),
+		ExitCode: 1,
+	}
+}
+
+// MigratorRoleChanged is the output of a successful `gh gei grant-migrator-role` (or `revoke-migrator-role`).
+func MigratorRoleChanged(revoke bool) FakeScript {
+	if revoke {
+		return FakeScript{
+			Lines: []FakeLine{
+				{0, "[INFO] Revoking migrator role ..."},
+				{0, "[INFO] Successfully revoked the migrator role for {actor}"},
+			},
+		}
+	}
+	return FakeScript{
+		Lines: []FakeLine{
+			{0, "[INFO] Granting migrator role ..."},
+			{0, "[INFO] Successfully granted the migrator role to {actor}"},
+		},
+	}
+}
+
+// MannequinReclaimed is the output of a successful `gh gei reclaim-mannequin` for a single mannequin.
+func MannequinReclaimed() FakeScript {
+	return FakeScript{
+		Lines: []FakeLine{
+			{0, "[INFO] Reclaiming Mannequin..."},
+			{0, "[INFO] Successfully sent reclaim invitation to {target-user} for mannequin {mannequin-user}"},
+		},
+	}
+}
+
+// AlertsMigrated is the output of a successful `gh gei migrate-code-scanning-alerts` (or `migrate-secret-alerts`).
+func AlertsMigrated(step MigrationStep) FakeScript {
+	return FakeScript{
+		Lines: []FakeLine{
+			{0, fmt.Sprintf("[INFO] Migrating %s from {source-org}/{repo} to {target-org}/{target-repo}...", step.Name)},
+			{0, fmt.Sprintf("[INFO] %s migrated", step.Name)},
+		},
+	}
+}
+
+// MigrationQueued is the output of a `gh gei migrate-repo --queue-only`.
+func MigrationQueued() FakeScript {
+	return FakeScript{
+		Lines: migrationStarted(0, 0),
+	}
+}
+
+func migrationStarted(steps int, step time.Duration) []FakeLine {
+	lines := []FakeLine{
+		{0, "[INFO] Migrating Repo..."},
+		{0, "[INFO] GITHUB SOURCE ORG: {source-org}"},
+		{0, "[INFO] SOURCE REPO: {repo}"},
+		{0, "[INFO] GITHUB TARGET ORG: {target-org}"},
+		{0, "[INFO] TARGET REPO: {target-repo}"},
+		{step, "[INFO] A repository migration (ID: {migration-id}) was successfully queued."},
+	}
+	if steps > 0 {
+		lines = append(lines, FakeLine{0, "[INFO] Waiting for migration (ID: {migration-id}) to finish..."})
+	}
+	for range steps {
+		lines = append(lines, FakeLine{step, "[INFO] Migration in progress (ID: {migration-id}). State: IN_PROGRESS. Waiting 10 seconds..."})
+	}
+	return lines
+}
+
+func NewFakeExecutor(defaultScript FakeScript) *FakeExecutor {
+	return &FakeExecutor{
+		Default: defaultScript,
+		Scripts: map[string]FakeScript{},
+	}
+}
+
+// FakeExecutor replays scripted GEI output instead of running gh, for tests and demos. migrate-repo commands replay
+// the script of their source repo (`--source-repo`, `--ado-repo` or `--bbs-repo`). Other commands replay that of their
+// subcommand and repo (e.g. `migrate-secret-alerts billing`) or else of their subcommand (e.g. `grant-migrator-role`).
+// Commands without a script replay Default.
+type FakeExecutor struct {
+	Default FakeScript
+	Scripts map[string]FakeScript
+
+	mu         sync.Mutex
+	commands   []Command
+	started    int
+	running    int
+	maxRunning int
+}
+
+func (e *FakeExecutor) Start(cmd Command) (Process, error) {
+	args := commandArgs(cmd)
+	repo := firstArg(args, "--source-repo", "--ado-repo", "--bbs-repo")
+	keys := []string{repo}
+	if len(cmd.Args) > 1 && cmd.Args[1] != "migrate-repo" {
+		keys = []string{cmd.Args[1] + " " + repo, cmd.Args[1]}
+	}
+	script := e.Default
+	for _, key := range keys {
+		if s, ok := e.Scripts[key]; ok {
+			script = s
+			break
+		}
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.commands = append(e.commands, cmd)
+	if script.StartErr != nil {
+		return nil, script.StartErr
+	}
+	e.started++
+	e.running++
+	e.maxRunning = max(e.maxRunning, e.running)
+
+	p := &fakeProcess{
+		script: script,
+		replacer: strings.NewReplacer(
+			"{repo}", repo,
+			"{target-repo}", firstArg(args, "--target-repo", "--github-repo", "--source-repo"),
+			"{source-org}", firstArg(args, "--github-source-org", "--ado-team-project", "--bbs-project", "--source-org"),
+			"{target-org}", firstArg(args, "--github-target-org", "--github-org", "--target-org"),
+			"{actor}", args["--actor"],
+			"{mannequin-user}", args["--mannequin-user"],
+			"{target-user}", args["--target-user"],
+			"{migration-id}", fmt.Sprintf("RM_kgDaAC%08d", e.started),
+		),
+		lines:  make(chan string),
+		killed: make(chan struct{}),
+		exited: func() {
+			e.mu.Lock()
+			defer e.mu.Unlock()
+			e.running--
+		},
+	}
+	go p.run()
+	return p, nil
+}
+
+// Commands returns every command started so far.
+func (e *FakeExecutor) Commands() []Command {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return slices.Clone(e.commands)
+}
+
+// MaxRunning is the most commands that have run at the same time.
+func (e *FakeExecutor) MaxRunning() int {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.maxRunning
+}
+
+// commandArgs maps the flags of a command to their values.
+func commandArgs(cmd Command) map[string]string {
+	args := map[string]string{}
+	for i, arg := range cmd.Args {
+		if strings.HasPrefix(arg, "--") && i+1 < len(cmd.Args) && !strings.HasPrefix(cmd.Args[i+1], "--") {
+			args[arg] = cmd.Args[i+1]
+		}
+	}
+	return args
+}
+
+// firstArg is the value of the first of flags the command has, since each gh extension names them differently.
+func firstArg(args map[string]string, flags ...string) string {
+	for _, flag := range flags {
+		if value := args[flag]; value != "" {
+			return value
+		}
+	}
+	return ""
+}
+
+type fakeProcess struct {
+	script   FakeScript
+	replacer *strings.Replacer
+	lines    chan string
+	exited   func()
+
+	killOnce   sync.Once
+	killed     chan struct{}
+	completed  bool // every line was written, set before lines is closed
+	exitedOnce sync.Once
+}
+
+func (p *fakeProcess) run() {
+	defer close(p.lines)
+	for _, line := range p.script.Lines {
+		select {
+		case <-time.After(line.After):
+		case <-p.killed:
+			return
+		}
+		select {
+		case p.lines <- p.replacer.Replace(line.Text):
+		case <-p.killed:
+			return
+		}
+	}
+	p.completed = true
+}
+
+func (p *fakeProcess) Output() <-chan string {
+	return p.lines
+}
+
+func (p *fakeProcess) Wait() int {
+	for range p.lines {
+		// drain anything left if the caller stopped reading
+	}
+	p.exitedOnce.Do(p.exited)
+	if !p.completed {
+		return -1
+	}
+	return p.script.ExitCode
+}
+
+func (p *fakeProcess) Kill() error {
+	p.killOnce.Do(func() { close(p.killed) })
+	return nil
+}
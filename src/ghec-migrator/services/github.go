@@ -2,8 +2,11 @@ package services
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
-	"os"
+	"net/http"
+	"slices"
 	"strings"
 
 	"github.com/google/go-github/v74/github"
@@ -18,37 +21,83 @@ const (
 	Target ClientType = "target"
 )
 
+// ErrInvalidClientType is returned for a side of the migration that's neither the source nor the target.
+var ErrInvalidClientType = errors.New("invalid client, expected source or target")
+
+func (t ClientType) Validate() error {
+	if t != Source && t != Target {
+		return fmt.Errorf("%w: %q", ErrInvalidClientType, t)
+	}
+	return nil
+}
+
 type GitHubService interface {
-	Token(c echo.Context, t ClientType) (string, error)
+	Token(c echo.Context, t ClientType) (Token, error)
 	Orgs(c echo.Context, t ClientType) ([]string, error)
-	Repos(c echo.Context, t ClientType, org string) ([]string, error)
+	// the Source methods take the source's GitHub Enterprise Server URL, empty for GitHub.com
+	SourceOrgs(sourceURL string, sourceToken string) ([]string, error)
+	OrgRepos(sourceURL string, sourceToken string, org string) ([]string, error)
 	Scopes(c echo.Context, t ClientType) ([]string, error)
+	SourceScopes(sourceURL string, sourceToken string) ([]string, error)
+	OrgPermissions(c echo.Context, t ClientType, org string) error
+	SourceOrgPermissions(sourceURL string, sourceToken string, org string) error
+	AbortMigration(targetToken string, migrationID string) error
+	RepositoryMigrations(targetToken string, migrationIDs []string) ([]RepositoryMigration, error)
+	Mannequins(targetToken string, org string) ([]Mannequin, error)
+	OrgMembers(targetToken string, org string) ([]OrgMember, error)
+	SourceRepo(sourceURL string, sourceToken string, org string, repo string) (RepoFacts, error)
+	RepoExists(targetToken string, org string, repo string) (bool, error)
+}
+
+// RepositoryMigration is the target's view of a GEI repository migration.
+type RepositoryMigration struct {
+	ID             string
+	RepositoryName string
+	State          string
+	FailureReason  string
 }
 
-func NewGitHubService(tokenService TokenService) *GitHubAPIService {
+func NewGitHubService(tokenService TokenService, target GitHubTarget) *GitHubAPIService {
 	return &GitHubAPIService{
 		tokenService: tokenService,
+		target:       target,
 	}
 }
 
 type GitHubAPIService struct {
 	tokenService TokenService
+	target       GitHubTarget
 }
 
-func (gs *GitHubAPIService) Token(c echo.Context, t ClientType) (string, error) {
-	token, err := gs.tokenService.Token(c, t)
-	if err != nil {
-		return "", err
-	}
-	return token.PersonalAccess, nil
+func (gs *GitHubAPIService) Token(c echo.Context, t ClientType) (Token, error) {
+	return gs.tokenService.Token(c, t)
 }
 
 func (gs *GitHubAPIService) Orgs(c echo.Context, t ClientType) ([]string, error) {
-	ctx := context.Background()
+	if app, err := gs.app(c, t); app != nil || err != nil {
+		if err != nil {
+			return []string{}, err
+		}
+		return app.Orgs()
+	}
 	client, err := gs.client(c, t)
 	if err != nil {
 		return []string{}, fmt.Errorf("error getting client: %w", err)
 	}
+	return listOrgs(client)
+}
+
+// SourceOrgs lists the orgs a source token can see, for the source provider which holds the token itself.
+func (gs *GitHubAPIService) SourceOrgs(sourceURL string, sourceToken string) ([]string, error) {
+	client, err := gs.tokenClient(sourceToken, sourceURL)
+	if err != nil {
+		return []string{}, fmt.Errorf("error getting client: %w", err)
+	}
+	return listOrgs(client)
+}
+
+func listOrgs(client *githubClient.Client) ([]string, error) {
+	ctx := context.Background()
 	opt := &github.ListOptions{
 		PerPage: 100,
 	}
@@ -69,12 +118,17 @@ func (gs *GitHubAPIService) Orgs(c echo.Context, t ClientType) ([]string, error)
 	return allOrgs, nil
 }
 
-func (gs *GitHubAPIService) Repos(c echo.Context, t ClientType, org string) ([]string, error) {
-	ctx := context.Background()
-	client, err := gs.client(c, t)
+// OrgRepos lists the repos of a source org for a run, which no longer has the session that started it.
+func (gs *GitHubAPIService) OrgRepos(sourceURL string, sourceToken string, org string) ([]string, error) {
+	client, err := gs.tokenClient(sourceToken, sourceURL)
 	if err != nil {
 		return []string{}, fmt.Errorf("error getting client: %w", err)
 	}
+	return listRepos(client, org)
+}
+
+func listRepos(client *githubClient.Client, org string) ([]string, error) {
+	ctx := context.Background()
 	opt := &github.RepositoryListByOrgOptions{
 		ListOptions: github.ListOptions{
 			PerPage: 100,
@@ -84,7 +138,7 @@ func (gs *GitHubAPIService) Repos(c echo.Context, t ClientType, org string) ([]s
 	for {
 		repos, resp, err := client.Repositories.ListByOrg(ctx, org, opt)
 		if err != nil {
-			return []string{}, fmt.Errorf("error listing orgs: %w", err)
+			return []string{}, fmt.Errorf("error listing repos: %w", err)
 		}
 		for _, repo := range repos {
 			allRepos = append(allRepos, repo.GetName())
@@ -97,30 +151,195 @@ func (gs *GitHubAPIService) Repos(c echo.Context, t ClientType, org string) ([]s
 	return allRepos, nil
 }
 
+// Scopes lists the scopes of the session's token. A GitHub App has no scopes, its installations' permissions are what
+// count, so once the app is known to authenticate it's taken to have the scopes migrations need.
 func (gs *GitHubAPIService) Scopes(c echo.Context, t ClientType) ([]string, error) {
-	ctx := context.Background()
+	if app, err := gs.app(c, t); app != nil || err != nil {
+		if err != nil {
+			return []string{}, err
+		}
+		if err := app.Validate(); err != nil {
+			return []string{}, err
+		}
+		return requiredScopes, nil
+	}
+	token, err := gs.tokenService.Token(c, t)
+	if err != nil {
+		return []string{}, err
+	}
 	client, err := gs.client(c, t)
 	if err != nil {
 		return []string{}, fmt.Errorf("error getting scopes: %w", err)
 	}
+	return scopes(client, token.PersonalAccess)
+}
+
+func (gs *GitHubAPIService) SourceScopes(sourceURL string, sourceToken string) ([]string, error) {
+	client, err := gs.tokenClient(sourceToken, sourceURL)
+	if err != nil {
+		return []string{}, fmt.Errorf("error getting scopes: %w", err)
+	}
+	return scopes(client, sourceToken)
+}
+
+// scopes lists a classic PAT's scopes. A fine-grained PAT has none, it's taken to have the scopes migrations need once
+// it authenticates, and its permissions are probed per org instead (see OrgPermissions).
+func scopes(client *githubClient.Client, token string) ([]string, error) {
+	ctx := context.Background()
 	_, resp, err := client.RateLimit.Get(ctx)
 	if err != nil {
 		return []string{}, fmt.Errorf("error getting scopes: %w", err)
 	}
+	if isFineGrained(token) {
+		return requiredScopes, nil
+	}
 	scopesStr := resp.Header.Get("x-oauth-scopes")
 	scopes := strings.Split(scopesStr, ", ")
 	return scopes, nil
 }
 
+// AbortMigration aborts a queued or in-progress repository migration on the target.
+func (gs *GitHubAPIService) AbortMigration(targetToken string, migrationID string) error {
+	ctx := context.Background()
+	client, err := gs.tokenClient(targetToken, gs.target.APIURL())
+	if err != nil {
+		return fmt.Errorf("error getting client: %w", err)
+	}
+	query := `mutation($id: ID!) { abortRepositoryMigration(input: {migrationId: $id}) { success } }`
+	var data struct {
+		AbortRepositoryMigration struct {
+			Success bool
+		}
+	}
+	err = gs.graphQL(ctx, client, query, map[string]any{"id": migrationID}, &data)
+	if err != nil {
+		return fmt.Errorf("error aborting migration %s: %w", migrationID, err)
+	}
+	if !data.AbortRepositoryMigration.Success {
+		return fmt.Errorf("error aborting migration %s: not aborted", migrationID)
+	}
+	return nil
+}
+
+// RepositoryMigrations looks up the current state of repository migrations on the target.
+func (gs *GitHubAPIService) RepositoryMigrations(targetToken string, migrationIDs []string) ([]RepositoryMigration, error) {
+	ctx := context.Background()
+	client, err := gs.tokenClient(targetToken, gs.target.APIURL())
+	if err != nil {
+		return []RepositoryMigration{}, fmt.Errorf("error getting client: %w", err)
+	}
+	query := `query($ids: [ID!]!) {
+		nodes(ids: $ids) {
+			... on RepositoryMigration { id repositoryName state failureReason }
+		}
+	}`
+	var allMigrations []RepositoryMigration
+	// the API looks up at most 100 nodes at a time
+	for ids := range slices.Chunk(migrationIDs, 100) {
+		var data struct {
+			Nodes []*RepositoryMigration
+		}
+		err = gs.graphQL(ctx, client, query, map[string]any{"ids": ids}, &data)
+		if err != nil {
+			return []RepositoryMigration{}, fmt.Errorf("error getting migrations: %w", err)
+		}
+		for _, migration := range data.Nodes {
+			if migration != nil {
+				allMigrations = append(allMigrations, *migration)
+			}
+		}
+	}
+	return allMigrations, nil
+}
+
+// graphQL runs a GraphQL query against the client's API and decodes the response data into data.
+func (gs *GitHubAPIService) graphQL(ctx context.Context, client *githubClient.Client, query string, variables map[string]any, data any) error {
+	body := map[string]any{
+		"query":     query,
+		"variables": variables,
+	}
+	req, err := client.NewRequest("POST", "graphql", body)
+	if err != nil {
+		return err
+	}
+	var resp struct {
+		Data   json.RawMessage
+		Errors []graphQLError
+	}
+	if _, err := client.Do(ctx, req, &resp); err != nil {
+		return err
+	}
+	if len(resp.Errors) != 0 {
+		var errs []error
+		for _, e := range resp.Errors {
+			errs = append(errs, e)
+		}
+		return errors.Join(errs...)
+	}
+	return json.Unmarshal(resp.Data, data)
+}
+
+// rejected reports whether the API refused a request for what it asked, rather than failing to answer it.
+func rejected(err error) bool {
+	var errResp *githubClient.ErrorResponse
+	if !errors.As(err, &errResp) || errResp.Response == nil {
+		return false
+	}
+	switch errResp.Response.StatusCode {
+	case http.StatusForbidden, http.StatusNotFound, http.StatusUnprocessableEntity:
+		return true
+	}
+	return false
+}
+
+// graphQLError is an error the GraphQL API answered a query with.
+type graphQLError struct {
+	Type    string // e.g. FORBIDDEN or NOT_FOUND
+	Message string
+}
+
+func (e graphQLError) Error() string {
+	return e.Message
+}
+
+// forbidden reports whether a GraphQL query failed because the token's user isn't allowed to make it.
+func forbidden(err error) bool {
+	var gqlErr graphQLError
+	return errors.As(err, &gqlErr) && gqlErr.Type == "FORBIDDEN"
+}
+
+// app is the target's GitHub App if the session authenticates as it, nil for a PAT.
+func (gs *GitHubAPIService) app(c echo.Context, t ClientType) (*GitHubApp, error) {
+	token, err := gs.tokenService.Token(c, t)
+	if err != nil || !token.App {
+		return nil, err
+	}
+	if t != Target || gs.target.App == nil {
+		return nil, ErrAppNotConfigured
+	}
+	return gs.target.App, nil
+}
+
+// client builds a client for the session's token for a side of the migration, on the target's GHE.com tenant if it
+// has one and otherwise on GitHub.com. Source tokens for GitHub Enterprise Server are used through their source
+// provider instead, which knows the server's URL.
 func (gs *GitHubAPIService) client(c echo.Context, t ClientType) (*githubClient.Client, error) {
 	token, err := gs.tokenService.Token(c, t)
 	if err != nil {
 		return nil, err
 	}
-	client := github.NewClient(nil).WithAuthToken(token.PersonalAccess)
-	enterpriseSource := os.Getenv("GITHUB_ENTERPRISE_SOURCE_URL")
-	if enterpriseSource != "" {
-		client.WithEnterpriseURLs(enterpriseSource, enterpriseSource)
+	if t == Target {
+		return gs.tokenClient(token.PersonalAccess, gs.target.APIURL())
+	}
+	return gs.tokenClient(token.PersonalAccess, "")
+}
+
+// tokenClient builds a client for a token held outside of the session (e.g. by a running migration), for GitHub
+// Enterprise Server or a GHE.com tenant when enterpriseURL is set.
+func (gs *GitHubAPIService) tokenClient(token string, enterpriseURL string) (*githubClient.Client, error) {
+	client := github.NewClient(nil).WithAuthToken(token)
+	if enterpriseURL != "" {
+		return client.WithEnterpriseURLs(enterpriseURL, enterpriseURL)
 	}
 	return client, nil
 }
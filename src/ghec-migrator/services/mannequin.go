@@ -0,0 +1,445 @@
+package services
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+var (
+	ErrInvalidReclaim      = errors.New("invalid mannequin reclaim")
+	ErrInvalidMannequinCSV = errors.New("invalid mannequin CSV")
+)
+
+// Mannequin is a placeholder user a migration attributes a source user's activity to in the target org, until it's
+// reclaimed by (attributed to) a target user.
+type Mannequin struct {
+	ID       string
+	Login    string
+	Email    string
+	Claimant string // login of the target user it was reclaimed by, empty until then
+}
+
+// OrgMember is a target org member a mannequin can be reclaimed by. Email is only known when it's public.
+type OrgMember struct {
+	Login string
+	Email string
+}
+
+// MannequinReclaim asks TargetUser to accept a mannequin's activity, which happens once they accept the invitation
+// GitHub sends them. Reclaims are recorded as runs, RunRecord.TargetOrg being the org.
+type MannequinReclaim struct {
+	MannequinUser string
+	MannequinID   string
+	TargetUser    string
+	ExitCode      *int // of the reclaim's `gh gei reclaim-mannequin`, nil until it exits
+}
+
+type ReclaimState string
+
+const (
+	ReclaimSubmitting ReclaimState = "submitting"
+	ReclaimInvited    ReclaimState = "invited"
+	ReclaimFailed     ReclaimState = "failed"
+	ReclaimAccepted   ReclaimState = "reclaimed"
+)
+
+// MannequinStatus is a mannequin in a target org, with the target user suggested for it and its latest reclaim.
+type MannequinStatus struct {
+	Mannequin
+	Suggestion string            // org member matching the mannequin's login or email, if exactly one does
+	Reclaim    *MannequinReclaim // latest reclaim submitted here, nil if there's none
+	RunID      string            // run of Reclaim
+}
+
+// State is how far the mannequin's reclaim got, empty if it hasn't been reclaimed. GitHub only shows whether a
+// mannequin has been claimed, so an invitation stays invited until it's accepted.
+func (s MannequinStatus) State() ReclaimState {
+	switch {
+	case s.Claimant != "":
+		return ReclaimAccepted
+	case s.Reclaim == nil:
+		return ""
+	case s.Reclaim.ExitCode == nil:
+		return ReclaimSubmitting
+	case *s.Reclaim.ExitCode != 0:
+		return ReclaimFailed
+	default:
+		return ReclaimInvited
+	}
+}
+
+// Assignment is who the mannequin is (or is to be) reclaimed by: its claimant, the target user of its latest reclaim,
+// or else the org member suggested for it.
+func (s MannequinStatus) Assignment() string {
+	switch {
+	case s.Claimant != "":
+		return s.Claimant
+	case s.Reclaim != nil:
+		return s.Reclaim.TargetUser
+	default:
+		return s.Suggestion
+	}
+}
+
+type MannequinService interface {
+	// Mannequins lists the mannequins in org, and the reclaims submitted for them, most recent first.
+	Mannequins(c echo.Context, org string) ([]MannequinStatus, []RunRecord, error)
+	// Reclaim starts a run of `gh gei reclaim-mannequin` for each reclaim with the session's target token, and returns
+	// the run's ID.
+	Reclaim(c echo.Context, org string, reclaims []MannequinReclaim) (string, error)
+}
+
+func NewMannequinService(gitHubService GitHubService, target GitHubTarget, runStore RunStore, executor Executor) MannequinService {
+	return &MannequinServiceImpl{
+		gitHubService: gitHubService,
+		target:        target,
+		runStore:      runStore,
+		executor:      executor,
+	}
+}
+
+type MannequinServiceImpl struct {
+	gitHubService GitHubService
+	target        GitHubTarget
+	runStore      RunStore
+	executor      Executor
+}
+
+func (ms *MannequinServiceImpl) Mannequins(c echo.Context, org string) ([]MannequinStatus, []RunRecord, error) {
+	targetToken, err := ms.targetToken(c, org)
+	if err != nil {
+		return nil, nil, err
+	}
+	mannequins, err := ms.gitHubService.Mannequins(targetToken, org)
+	if err != nil {
+		return nil, nil, err
+	}
+	members, err := ms.gitHubService.OrgMembers(targetToken, org)
+	if err != nil {
+		return nil, nil, err
+	}
+	runs, err := ms.runStore.Runs()
+	if err != nil {
+		return nil, nil, err
+	}
+	var reclaimRuns []RunRecord
+	for _, run := range runs {
+		if len(run.Reclaims) != 0 && run.TargetOrg == org {
+			reclaimRuns = append(reclaimRuns, run)
+		}
+	}
+	slices.SortFunc(reclaimRuns, func(a, b RunRecord) int {
+		return b.QueuedAt.Compare(a.QueuedAt)
+	})
+	var statuses []MannequinStatus
+	for _, mannequin := range mannequins {
+		status := MannequinStatus{Mannequin: mannequin, Suggestion: suggestMember(mannequin, members)}
+	runs:
+		for _, run := range reclaimRuns {
+			for _, reclaim := range run.Reclaims {
+				if reclaim.MannequinID == mannequin.ID {
+					status.Reclaim = &reclaim
+					status.RunID = run.ID
+					break runs
+				}
+			}
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses, reclaimRuns, nil
+}
+
+// suggestMember picks the org member a mannequin most likely is: the one with its email, or else its login (or its
+// login with a managed user's _shortcode suffix).
+func suggestMember(mannequin Mannequin, members []OrgMember) string {
+	matches := []func(OrgMember) bool{
+		func(m OrgMember) bool {
+			return mannequin.Email != "" && strings.EqualFold(m.Email, mannequin.Email)
+		},
+		func(m OrgMember) bool {
+			return strings.EqualFold(m.Login, mannequin.Login)
+		},
+		func(m OrgMember) bool {
+			i := strings.LastIndex(m.Login, "_")
+			return i != -1 && strings.EqualFold(m.Login[:i], mannequin.Login)
+		},
+	}
+	for _, match := range matches {
+		var found []string
+		for _, member := range members {
+			if match(member) {
+				found = append(found, member.Login)
+			}
+		}
+		// an ambiguous match is left to whoever reclaims
+		if len(found) == 1 {
+			return found[0]
+		}
+	}
+	return ""
+}
+
+func (ms *MannequinServiceImpl) Reclaim(c echo.Context, org string, reclaims []MannequinReclaim) (string, error) {
+	if org == "" {
+		return "", fmt.Errorf("%w: missing org", ErrInvalidReclaim)
+	}
+	if len(reclaims) == 0 {
+		return "", fmt.Errorf("%w: no target users picked", ErrInvalidReclaim)
+	}
+	for _, reclaim := range reclaims {
+		if reclaim.MannequinUser == "" || reclaim.MannequinID == "" || reclaim.TargetUser == "" {
+			return "", fmt.Errorf("%w: %q needs a mannequin and a target user", ErrInvalidReclaim, reclaim.MannequinUser)
+		}
+	}
+	credentials, err := ms.targetCredentials(c, org)
+	if err != nil {
+		return "", err
+	}
+	// minted now only so a missing installation is reported right away
+	if _, err := ms.target.token(credentials, org); err != nil {
+		return "", err
+	}
+	id, err := generateStreamName()
+	if err != nil {
+		return "", err
+	}
+	record := RunRecord{
+		ID:        id,
+		TargetOrg: org,
+		Reclaims:  reclaims,
+		QueuedAt:  time.Now(),
+	}
+	if err := ms.runStore.CreateRun(record); err != nil {
+		return "", fmt.Errorf("error recording run: %w", err)
+	}
+	if err := ms.runStore.StartRun(id); err != nil {
+		return "", fmt.Errorf("error recording run: %w", err)
+	}
+	// each reclaim is a few GraphQL calls, but there can be hundreds of mannequins after a large migration
+	go ms.run(id, org, credentials, reclaims)
+	return id, nil
+}
+
+// run reclaims one mannequin at a time, so each has its own exit code, and fails the run if any reclaim failed. A GitHub
+// App's installation token can expire before hundreds of reclaims are through, so each reclaim gets a fresh one.
+func (ms *MannequinServiceImpl) run(id string, org string, credentials Credentials, reclaims []MannequinReclaim) {
+	exitCode := 0
+	for _, reclaim := range reclaims {
+		code := ms.reclaim(id, org, credentials, reclaim)
+		reclaim.ExitCode = &code
+		if err := ms.runStore.SaveReclaims(id, reclaim); err != nil {
+			ms.runStore.AppendOutput(id, fmt.Sprintf("error recording reclaim: %v", err))
+		}
+		if code != 0 {
+			exitCode = code
+		}
+	}
+	ms.runStore.FinishRun(id, exitCode)
+}
+
+// reclaim runs `gh gei reclaim-mannequin` for a single mannequin and returns its exit code.
+func (ms *MannequinServiceImpl) reclaim(id string, org string, credentials Credentials, reclaim MannequinReclaim) int {
+	targetToken, err := ms.target.token(credentials, org)
+	if err != nil {
+		ms.runStore.AppendOutput(id, repoLine(reclaim.MannequinUser, fmt.Sprintf("error getting target token: %v", err)))
+		return -1
+	}
+	args := []string{
+		"gei",
+		"reclaim-mannequin",
+		"--github-target-org", org,
+		"--mannequin-user", reclaim.MannequinUser,
+		"--mannequin-id", reclaim.MannequinID,
+		"--target-user", reclaim.TargetUser,
+	}
+	cmd := Command{
+		Args: append(args, ms.target.args()...),
+		Env:  targetEnv(targetToken),
+	}
+	return runCommand(ms.executor, cmd, func(line string) {
+		if err := ms.runStore.AppendOutput(id, repoLine(reclaim.MannequinUser, line)); err != nil {
+			log.Printf("error recording output for run %s: %v", id, err)
+		}
+	}, nil)
+}
+
+func (ms *MannequinServiceImpl) targetToken(c echo.Context, org string) (string, error) {
+	credentials, err := ms.targetCredentials(c, org)
+	if err != nil {
+		return "", err
+	}
+	return ms.target.token(credentials, org)
+}
+
+// targetCredentials are the session's target credentials, for managing org's mannequins.
+func (ms *MannequinServiceImpl) targetCredentials(c echo.Context, org string) (Credentials, error) {
+	token, err := ms.gitHubService.Token(c, Target)
+	if err != nil {
+		return Credentials{}, err
+	}
+	if token.App {
+		// the installation can reclaim any mannequin, so its user has to be allowed to
+		if err := ms.gitHubService.OrgPermissions(c, Target, org); err != nil {
+			return Credentials{}, err
+		}
+	}
+	return Credentials{TargetToken: token.PersonalAccess, TargetApp: token.App}, nil
+}
+
+// mannequinCSVHeader is the header of the CSV `gh gei generate-mannequin-csv` writes and `reclaim-mannequin --csv` reads.
+var mannequinCSVHeader = []string{"mannequin-user", "mannequin-id", "target-user"}
+
+// WriteMannequinCSV writes reclaims in the format of `gh gei generate-mannequin-csv`, so they can be edited offline.
+func WriteMannequinCSV(w io.Writer, reclaims []MannequinReclaim) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(mannequinCSVHeader); err != nil {
+		return err
+	}
+	for _, reclaim := range reclaims {
+		if err := cw.Write([]string{reclaim.MannequinUser, reclaim.MannequinID, reclaim.TargetUser}); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// ParseMannequinCSV reads reclaims from a CSV in the format of `gh gei generate-mannequin-csv`. Rows without a target
+// user are skipped, as GEI does.
+func ParseMannequinCSV(r io.Reader) ([]MannequinReclaim, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = len(mannequinCSVHeader)
+	header, err := cr.Read()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidMannequinCSV, err)
+	}
+	if !slices.EqualFunc(header, mannequinCSVHeader, func(a, b string) bool {
+		return strings.EqualFold(strings.TrimSpace(a), b)
+	}) {
+		return nil, fmt.Errorf("%w: header has to be %s", ErrInvalidMannequinCSV, strings.Join(mannequinCSVHeader, ","))
+	}
+	var reclaims []MannequinReclaim
+	for {
+		row, err := cr.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrInvalidMannequinCSV, err)
+		}
+		reclaim := MannequinReclaim{
+			MannequinUser: strings.TrimSpace(row[0]),
+			MannequinID:   strings.TrimSpace(row[1]),
+			TargetUser:    strings.TrimSpace(row[2]),
+		}
+		if reclaim.TargetUser != "" {
+			reclaims = append(reclaims, reclaim)
+		}
+	}
+	return reclaims, nil
+}
+
+// Mannequins lists the mannequins in a target org, as `gh gei generate-mannequin-csv --include-reclaimed` does.
+func (gs *GitHubAPIService) Mannequins(targetToken string, org string) ([]Mannequin, error) {
+	ctx := context.Background()
+	client, err := gs.tokenClient(targetToken, gs.target.APIURL())
+	if err != nil {
+		return nil, fmt.Errorf("error getting client: %w", err)
+	}
+	query := `query($org: String!, $after: String) {
+		organization(login: $org) {
+			mannequins(first: 100, after: $after) {
+				pageInfo { hasNextPage endCursor }
+				nodes { id login email claimant { login } }
+			}
+		}
+	}`
+	var mannequins []Mannequin
+	var after *string
+	for {
+		var data struct {
+			Organization struct {
+				Mannequins struct {
+					PageInfo graphQLPageInfo
+					Nodes    []struct {
+						ID       string
+						Login    string
+						Email    string
+						Claimant *struct{ Login string }
+					}
+				}
+			}
+		}
+		err = gs.graphQL(ctx, client, query, map[string]any{"org": org, "after": after}, &data)
+		if err != nil {
+			return nil, fmt.Errorf("error listing mannequins: %w", err)
+		}
+		for _, node := range data.Organization.Mannequins.Nodes {
+			mannequin := Mannequin{ID: node.ID, Login: node.Login, Email: node.Email}
+			if node.Claimant != nil {
+				mannequin.Claimant = node.Claimant.Login
+			}
+			mannequins = append(mannequins, mannequin)
+		}
+		pageInfo := data.Organization.Mannequins.PageInfo
+		if !pageInfo.HasNextPage {
+			break
+		}
+		after = &pageInfo.EndCursor
+	}
+	return mannequins, nil
+}
+
+// OrgMembers lists a target org's members, to suggest who its mannequins are.
+func (gs *GitHubAPIService) OrgMembers(targetToken string, org string) ([]OrgMember, error) {
+	ctx := context.Background()
+	client, err := gs.tokenClient(targetToken, gs.target.APIURL())
+	if err != nil {
+		return nil, fmt.Errorf("error getting client: %w", err)
+	}
+	query := `query($org: String!, $after: String) {
+		organization(login: $org) {
+			membersWithRole(first: 100, after: $after) {
+				pageInfo { hasNextPage endCursor }
+				nodes { login email }
+			}
+		}
+	}`
+	var members []OrgMember
+	var after *string
+	for {
+		var data struct {
+			Organization struct {
+				MembersWithRole struct {
+					PageInfo graphQLPageInfo
+					Nodes    []OrgMember
+				}
+			}
+		}
+		err = gs.graphQL(ctx, client, query, map[string]any{"org": org, "after": after}, &data)
+		if err != nil {
+			return nil, fmt.Errorf("error listing members: %w", err)
+		}
+		members = append(members, data.Organization.MembersWithRole.Nodes...)
+		pageInfo := data.Organization.MembersWithRole.PageInfo
+		if !pageInfo.HasNextPage {
+			break
+		}
+		after = &pageInfo.EndCursor
+	}
+	return members, nil
+}
+
+type graphQLPageInfo struct {
+	HasNextPage bool
+	EndCursor   string
+}
@@ -0,0 +1,193 @@
+package services
+
+import (
+	"bytes"
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMannequinReclaims(t *testing.T) {
+	ts := newTestService(t, 1, 5)
+	ts.executor.Scripts["reclaim-mannequin"] = MannequinReclaimed()
+	ts.github.mannequins = []Mannequin{
+		{ID: "M1", Login: "jdoe"},
+		{ID: "M2", Login: "m-smith", Email: "maria.smith@acme.example"},
+		{ID: "M3", Login: "build-bot"},
+		{ID: "M4", Login: "akumar", Claimant: "akumar_acme"},
+	}
+	ts.github.members = []OrgMember{{Login: "jdoe_acme"}, {Login: "maria", Email: "Maria.Smith@acme.example"}}
+	ms := NewMannequinService(ts.github, GitHubTarget{}, ts.store, ts.executor)
+
+	mannequins, _, err := ms.Mannequins(nil, "target-org")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var suggestions []string
+	for _, m := range mannequins {
+		suggestions = append(suggestions, m.Suggestion)
+	}
+	if want := []string{"jdoe_acme", "maria", "", ""}; !slices.Equal(suggestions, want) {
+		t.Errorf("got suggestions %q, want %q", suggestions, want)
+	}
+
+	id, err := ms.Reclaim(nil, "target-org", []MannequinReclaim{
+		{MannequinUser: "jdoe", MannequinID: "M1", TargetUser: "jdoe_acme"},
+		{MannequinUser: "m-smith", MannequinID: "M2", TargetUser: "maria"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	run := ts.waitFor(t, id, RunRecord.Finished)
+	if run.Status != RunSucceeded || len(run.Reclaims) != 2 || run.Reclaims[1].ExitCode == nil {
+		t.Errorf("got run %+v", run)
+	}
+	if lines := RepoOutput(run.Output, "m-smith"); len(lines) == 0 || !strings.Contains(lines[len(lines)-1], "maria") {
+		t.Errorf("got output %v for m-smith", lines)
+	}
+	want := []string{"gei", "reclaim-mannequin", "--github-target-org", "target-org", "--mannequin-user", "jdoe", "--mannequin-id", "M1", "--target-user", "jdoe_acme"}
+	if commands := ts.executor.Commands(); len(commands) != 2 || !slices.Equal(commands[0].Args, want) {
+		t.Errorf("got commands %v, want two starting with %v", commands, want)
+	}
+
+	mannequins, reclaims, err := ms.Mannequins(nil, "target-org")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var states []ReclaimState
+	for _, m := range mannequins {
+		states = append(states, m.State())
+	}
+	if want := []ReclaimState{ReclaimInvited, ReclaimInvited, "", ReclaimAccepted}; !slices.Equal(states, want) {
+		t.Errorf("got states %q, want %q", states, want)
+	}
+	if len(reclaims) != 1 || reclaims[0].ID != id {
+		t.Errorf("got reclaims %+v, want run %s", reclaims, id)
+	}
+
+	if _, err := ms.Reclaim(nil, "target-org", nil); !errors.Is(err, ErrInvalidReclaim) {
+		t.Errorf("got %v, want ErrInvalidReclaim", err)
+	}
+}
+
+func TestMannequinReclaimFails(t *testing.T) {
+	ts := newTestService(t, 1, 5)
+	ts.executor.Scripts["reclaim-mannequin"] = FakeScript{
+		Lines:    []FakeLine{{0, "[ERROR] Target user not found"}},
+		ExitCode: 1,
+	}
+	ts.github.mannequins = []Mannequin{{ID: "M1", Login: "jdoe"}}
+	ms := NewMannequinService(ts.github, GitHubTarget{}, ts.store, ts.executor)
+
+	id, err := ms.Reclaim(nil, "target-org", []MannequinReclaim{{MannequinUser: "jdoe", MannequinID: "M1", TargetUser: "nobody"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	run := ts.waitFor(t, id, RunRecord.Finished)
+	if run.Status != RunFailed || run.ExitCode != 1 {
+		t.Errorf("got status %s exit code %d, want failed with 1", run.Status, run.ExitCode)
+	}
+	mannequins, _, err := ms.Mannequins(nil, "target-org")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mannequins[0].State() != ReclaimFailed || mannequins[0].Assignment() != "nobody" {
+		t.Errorf("got state %q assigned to %q, want failed for nobody", mannequins[0].State(), mannequins[0].Assignment())
+	}
+}
+
+func TestMannequinReclaimsMintTokenPerReclaim(t *testing.T) {
+	ts := newTestService(t, 1, 5)
+	ts.executor.Scripts["reclaim-mannequin"] = MannequinReclaimed()
+	ts.tokens.target = Token{App: true, Admin: true, Type: Target}
+	app := newTestApp(t)
+	// every token is about to expire by the time it's used again, as they all would be an hour into a large batch
+	app.lifetime.Store(int64(installationTokenMargin))
+	ms := NewMannequinService(ts.github, GitHubTarget{App: app.GitHubApp}, ts.store, ts.executor)
+
+	id, err := ms.Reclaim(nil, "target-org", []MannequinReclaim{
+		{MannequinUser: "jdoe", MannequinID: "M1", TargetUser: "jdoe_acme"},
+		{MannequinUser: "m-smith", MannequinID: "M2", TargetUser: "maria"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if run := ts.waitFor(t, id, RunRecord.Finished); run.Status != RunSucceeded {
+		t.Fatalf("got status %s, want succeeded", run.Status)
+	}
+	var tokens []string
+	for _, cmd := range ts.executor.Commands() {
+		for _, env := range cmd.Env {
+			if token, ok := strings.CutPrefix(env, "GH_PAT="); ok {
+				tokens = append(tokens, token)
+			}
+		}
+	}
+	if want := []string{"ghs_2_2", "ghs_2_3"}; !slices.Equal(tokens, want) {
+		t.Errorf("got tokens %v, want %v", tokens, want)
+	}
+}
+
+func TestInterruptedReclaimsFail(t *testing.T) {
+	ts := newTestService(t, 1, 5)
+	code := 0
+	id := "interrupted"
+	err := ts.store.CreateRun(RunRecord{
+		ID:        id,
+		TargetOrg: "target-org",
+		Reclaims: []MannequinReclaim{
+			{MannequinUser: "jdoe", MannequinID: "M1", TargetUser: "jdoe_acme", ExitCode: &code},
+			{MannequinUser: "rlee", MannequinID: "M2", TargetUser: "rlee_acme"},
+		},
+		QueuedAt: time.Now().Add(-time.Hour),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ts.store.StartRun(id); err != nil {
+		t.Fatal(err)
+	}
+	run, err := ts.store.Run(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ts.interrupted(run)
+	run, err = ts.store.Run(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if run.Status != RunFailed || *run.Reclaims[0].ExitCode != 0 || run.Reclaims[1].ExitCode == nil || *run.Reclaims[1].ExitCode != -1 {
+		t.Errorf("got run %+v, want the unsubmitted reclaim failed", run)
+	}
+}
+
+func TestMannequinCSV(t *testing.T) {
+	reclaims := []MannequinReclaim{
+		{MannequinUser: "jdoe", MannequinID: "M1", TargetUser: "jdoe_acme"},
+		{MannequinUser: "build-bot", MannequinID: "M2"},
+	}
+	var b bytes.Buffer
+	if err := WriteMannequinCSV(&b, reclaims); err != nil {
+		t.Fatal(err)
+	}
+	if want := "mannequin-user,mannequin-id,target-user\njdoe,M1,jdoe_acme\nbuild-bot,M2,\n"; b.String() != want {
+		t.Errorf("got %q, want %q", b.String(), want)
+	}
+
+	parsed, err := ParseMannequinCSV(&b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(parsed, reclaims[:1]) {
+		t.Errorf("got %+v, want only the row with a target user", parsed)
+	}
+
+	for _, csv := range []string{"", "login,id,user\njdoe,M1,jdoe_acme\n", "mannequin-user,mannequin-id,target-user\njdoe,M1\n"} {
+		if _, err := ParseMannequinCSV(strings.NewReader(csv)); !errors.Is(err, ErrInvalidMannequinCSV) {
+			t.Errorf("got %v for %q, want ErrInvalidMannequinCSV", err, csv)
+		}
+	}
+}
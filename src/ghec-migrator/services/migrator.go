@@ -1,28 +1,36 @@
 package services
 
 import (
-	"bufio"
 	"crypto/rand"
 	"encoding/base64"
 	"errors"
 	"fmt"
-	"io"
 	"log"
 	"os"
-	"os/exec"
+	"regexp"
 	"slices"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/labstack/echo/v4"
 )
 
+var activeJobs sync.Map // queued or running jobs, by run ID
+
 var (
-	outputMap sync.Map
-	runMutex  sync.Mutex
+	ErrRunNotActive   = errors.New("run is not queued or running")
+	ErrRunNotFinished = errors.New("run has not finished")
+	ErrNothingToRetry = errors.New("run has no failed repositories to retry")
+	// ErrTargetNameCollision is returned when target naming would give two source repos the same name
+	ErrTargetNameCollision = errors.New("target repository names collide")
 )
 
-var ErrMigrationInProgress = errors.New("migration in progress")
+// migrationIDPattern matches the GEI repository migration IDs printed once a migration is queued on the target.
+var migrationIDPattern = regexp.MustCompile(`RM_[A-Za-z0-9_-]+`)
+
+// requiredScopes are the classic PAT scopes GEI needs on GitHub.
+var requiredScopes = []string{"repo", "admin:org", "workflow"}
 
 func ErrMissingScopes(scopes []string) error {
 	return fmt.Errorf("missing scopes: %s", strings.Join(scopes, ", "))
@@ -31,25 +39,75 @@ func ErrMissingScopes(scopes []string) error {
 type MigratorService interface {
 	ValidToken(c echo.Context, t ClientType) error
 	Run(m Migration) (string, error)
-	Output(token string) ([]string, bool, error)
+	Readiness(m Migration) (string, error)
+	ReadinessCheck(id string) (ReadinessCheck, error)
+	Output(token string, from int) ([]string, bool, error)
+	QueuePosition(token string) int
+	Cancel(c echo.Context, token string) error
+	Retry(c echo.Context, runID string) (string, error)
+	Reschedule(c echo.Context, runID string, edit ScheduleEdit) error
 }
 
-func NewMigratorService(gs GitHubService) MigratorService {
-	return &MigratorServiceImpl{
+// NewMigratorService starts workers goroutines that handle queued migrations concurrently, along with
+// a tracker that finishes runs whose process is gone by polling the target's migration API. Each run
+// migrates up to concurrency repos at a time.
+func NewMigratorService(gs GitHubService, ss SourceService, target GitHubTarget, rs RunStore, executor Executor, workers int, concurrency int) MigratorService {
+	ms := &MigratorServiceImpl{
 		gitHubService: gs,
+		sourceService: ss,
+		target:        target,
+		runStore:      rs,
+		executor:      executor,
+		queue:         newJobQueue(),
+		concurrency:   max(concurrency, 1),
+		startedAt:     time.Now(),
+		misses:        map[string]int{},
+		reports:       map[string]cachedReport{},
+		checks:        map[string]*ReadinessCheck{},
+	}
+	for range max(workers, 1) {
+		go ms.worker()
 	}
+	go ms.tracker()
+	go ms.scheduler()
+	return ms
 }
 
 type MigratorServiceImpl struct {
 	gitHubService GitHubService
+	sourceService SourceService
+	target        GitHubTarget
+	runStore      RunStore
+	executor      Executor
+	queue         *jobQueue
+	concurrency   int        // repos migrated at the same time within a run
+	scheduleMutex sync.Mutex // serializes launching, rescheduling and cancelling scheduled runs
+	startedAt     time.Time
+	missesMutex   sync.Mutex
+	misses        map[string]int // consecutive polls the tracker didn't hear about each in-flight migration, by ID
+	reportsMutex  sync.Mutex
+	reports       map[string]cachedReport // readiness reports users were shown, by readinessKey
+	checksMutex   sync.Mutex
+	checks        map[string]*ReadinessCheck // readiness checks running in the background, and recently finished, by ID
 }
 
+// ValidToken checks the session's token for a side of the migration works for it, with whichever kind of source it's for.
 func (ms *MigratorServiceImpl) ValidToken(c echo.Context, t ClientType) error {
-	requiredScopes := []string{"repo", "admin:org", "workflow"}
+	if t == Source {
+		provider, token, err := ms.sourceService.SessionProvider(c)
+		if err != nil {
+			return err
+		}
+		return provider.ValidToken(token)
+	}
 	scopes, err := ms.gitHubService.Scopes(c, t)
 	if err != nil {
 		return err
 	}
+	return requireScopes(scopes)
+}
+
+func requireScopes(scopes []string) error {
 	var missingScopes []string
 	for _, scope := range requiredScopes {
 		if !slices.Contains(scopes, scope) {
@@ -65,20 +123,55 @@ func (ms *MigratorServiceImpl) ValidToken(c echo.Context, t ClientType) error {
 
 type Migration struct {
 	Context          echo.Context
-	SourceOrg        string
-	SourceRepo       string
+	Source           SourceKind // optional, defaults to the session's kind of source (and must match it when set)
+	SourceInstance   string     // optional, like Source
+	SourceOrg        string     // org, or the source's equivalent namespace
+	SourceRepos      []string   // optional, defaults to all repos in SourceOrg
 	TargetOrg        string
-	OutputStreamName string // optional
+	TargetNaming     TargetNaming // optional, defaults to keeping source repo names
+	Options          MigrationOptions
+	DryRun           bool      // only generate and record a migration plan
+	RetryOf          string    // optional, run whose failed repos are being retried
+	ScheduledFor     time.Time // optional, defaults to starting right away
+	OutputStreamName string    // optional
 }
 
-// Run executes a series of commands as documented by the ghes to ghec docs and returns an opaque string token for output polling.
+// Run queues a series of commands as documented by the ghes to ghec docs and returns an opaque string token for output polling.
 // See https://docs.github.com/en/migrations/using-github-enterprise-importer/migrating-between-github-products/migrating-repositories-from-github-enterprise-server-to-github-enterprise-cloud
-// In summary, it runs:
-// `gh gei generate-script --github-source-org SOURCE_ORG --github-target-org TARGET_ORG --output FILE`
-// and then
-// `./FILE` to migrate all repositories (if no target repository specified)
-// `gh gei migrate-repo --github-source-org SOURCE_ORG --source-repo SOURCE_REPO --github-target-org TARGET_ORG` to migrate a single repo
+// In summary, once a worker picks up the migration it runs
+// `gh gei migrate-repo --github-source-org SOURCE_ORG --source-repo SOURCE_REPO --github-target-org TARGET_ORG`
+// (with `--target-repo TARGET_REPO` when repos are renamed) for each selected repo, or each repo in the source org
+// if none are selected, several at a time. Azure DevOps and Bitbucket Server sources run `gh ado2gh migrate-repo`
+// and `gh bbs2gh migrate-repo` the same way. Unless it's a dry run, the repos are checked first: a run the user just
+// checked the readiness of is refused with a *NotReadyError if that report had blocking findings, and otherwise the
+// worker checks them before migrating anything, failing the run if they're blocked.
 func (ms *MigratorServiceImpl) Run(m Migration) (string, error) {
+	provider, sourceToken, err := ms.sourceService.SessionProvider(m.Context)
+	if err != nil {
+		return "", err
+	}
+	if m.Source != "" && (m.Source != provider.Kind() || m.SourceInstance != provider.Instance()) {
+		return "", fmt.Errorf("%w: this migration needs a %s source token", ErrSourceMismatch, strings.TrimSpace(fmt.Sprintf("%s %s", m.Source, m.SourceInstance)))
+	}
+	m.Source, m.SourceInstance = provider.Kind(), provider.Instance()
+	if err := m.Options.Validate(); err != nil {
+		return "", err
+	}
+	if err := m.Options.Supported(m.Source); err != nil {
+		return "", err
+	}
+	if err := provider.OrgPermissions(sourceToken, m.SourceOrg); err != nil {
+		return "", err
+	}
+	if err := ms.gitHubService.OrgPermissions(m.Context, Target, m.TargetOrg); err != nil {
+		return "", err
+	}
+	if err := m.TargetNaming.Validate(); err != nil {
+		return "", err
+	}
+	if err := m.TargetNaming.Collisions(m.SourceRepos); err != nil {
+		return "", err
+	}
 	if m.OutputStreamName == "" {
 		streamName, err := generateStreamName()
 		if err != nil {
@@ -86,157 +179,451 @@ func (ms *MigratorServiceImpl) Run(m Migration) (string, error) {
 		}
 		m.OutputStreamName = streamName
 	}
-	err := ms.run(m)
+	targetToken, err := ms.gitHubService.Token(m.Context, Target)
 	if err != nil {
 		return "", err
 	}
+	if targetToken.App {
+		if len(m.Options.Steps()) != 0 {
+			return "", fmt.Errorf("%w: alerts can't be migrated with a GitHub App target token, its migrations are only queued", ErrUnsupportedOption)
+		}
+		// an installation token outlives a queued migration but not necessarily one GEI waits on, so the tracker
+		// follows it instead, with a fresh token each time
+		m.Options.QueueOnly = true
+	}
+	credentials := Credentials{
+		SourceToken:    sourceToken.PersonalAccess,
+		SourceUsername: sourceToken.Username,
+		SourceApp:      sourceToken.App,
+		TargetToken:    targetToken.PersonalAccess,
+		TargetApp:      targetToken.App,
+	}
+	// checking takes a few API calls per repo, too many to make while the request waits on a large org
+	var ready bool
+	if report, ok := ms.cachedReport(m); ok && !m.DryRun {
+		if report.Blocked() {
+			return "", &NotReadyError{Report: report}
+		}
+		ready = true
+	}
+	record := RunRecord{
+		ID:             m.OutputStreamName,
+		Source:         m.Source,
+		SourceInstance: m.SourceInstance,
+		SourceOrg:      m.SourceOrg,
+		SourceRepos:    m.SourceRepos,
+		TargetOrg:      m.TargetOrg,
+		TargetNaming:   m.TargetNaming,
+		Options:        m.Options,
+		DryRun:         m.DryRun,
+		RetryOf:        m.RetryOf,
+		QueuedAt:       time.Now(),
+	}
+	if m.ScheduledFor.After(time.Now()) {
+		return m.OutputStreamName, ms.schedule(record, m.ScheduledFor, credentials)
+	}
+	j := newJob(m, credentials, provider)
+	j.ready = ready
+	// registered before the run is recorded so the tracker never mistakes it for an orphan
+	activeJobs.Store(m.OutputStreamName, j)
+	if err := ms.runStore.CreateRun(record); err != nil {
+		activeJobs.Delete(m.OutputStreamName)
+		return "", fmt.Errorf("error recording run: %w", err)
+	}
+	if err := ms.runStore.SaveCredentials(m.OutputStreamName, credentials); err != nil {
+		log.Printf("error saving credentials for run %s, it can't be tracked after a restart: %v", m.OutputStreamName, err)
+	}
+	ms.enqueue(j)
 	return m.OutputStreamName, nil
 }
 
-func (ms *MigratorServiceImpl) run(m Migration) error {
-	// this is subtle, we only lock around _starting_ a migration (generating the script and calling it),
-	// so there's no guarantee that the script currently on disk corresponds to the running migration.
-	success := runMutex.TryLock()
-	if success {
-		defer runMutex.Unlock()
-	} else {
-		return ErrMigrationInProgress
+func newJob(m Migration, credentials Credentials, source SourceProvider) *job {
+	return &job{
+		migration:   m,
+		source:      source,
+		credentials: credentials,
+		repos:       newRepoTracker(m),
 	}
-	sourceToken, err := ms.gitHubService.Token(m.Context, Source)
+}
+
+func (ms *MigratorServiceImpl) enqueue(j *job) {
+	ms.queue.push(j)
+}
+
+// Retry starts a new run migrating exactly the repos that failed in a finished run, linked to that run.
+func (ms *MigratorServiceImpl) Retry(c echo.Context, runID string) (string, error) {
+	run, err := ms.runStore.Run(runID)
 	if err != nil {
-		return err
+		return "", err
+	}
+	if !run.Finished() {
+		return "", ErrRunNotFinished
+	}
+	failed := run.FailedRepos()
+	if len(failed) == 0 {
+		return "", ErrNothingToRetry
+	}
+	m := Migration{
+		Context:        c,
+		Source:         run.Source,
+		SourceInstance: run.SourceInstance,
+		SourceOrg:      run.SourceOrg,
+		SourceRepos:    failed,
+		TargetOrg:      run.TargetOrg,
+		TargetNaming:   run.TargetNaming,
+		Options:        run.Options,
+		RetryOf:        run.ID,
+	}
+	return ms.Run(m)
+}
+
+// QueuePosition returns the 1-based position of a queued run, or 0 once it has started (or is unknown).
+func (ms *MigratorServiceImpl) QueuePosition(s string) int {
+	return ms.queue.position(s)
+}
+
+// Cancel drops a scheduled or queued run, kills the process tree of a running one, or stops following one whose
+// processes are gone. Any repository migrations the run already queued on the target are aborted so nothing is left
+// half-migrated. Run IDs are listed at /runs, so only a session whose target token could have started the run (it can
+// migrate into the run's target org) can cancel it.
+func (ms *MigratorServiceImpl) Cancel(c echo.Context, s string) error {
+	run, err := ms.runStore.Run(s)
+	if errors.Is(err, ErrRunNotFound) {
+		return ErrRunNotActive
 	}
-	targetToken, err := ms.gitHubService.Token(m.Context, Target)
 	if err != nil {
 		return err
 	}
-
-	runEnv := []string{
-		fmt.Sprintf("PATH=%s", os.Getenv("PATH")),
-		fmt.Sprintf("HOME=%s", os.Getenv("HOME")),
-		fmt.Sprintf("GH_TOKEN=%s", sourceToken),
-		fmt.Sprintf("GH_SOURCE_PAT=%s", sourceToken),
-		fmt.Sprintf("GH_PAT=%s", targetToken),
+	if run.Finished() {
+		// its job can linger for a moment after it's recorded as finished
+		return ErrRunNotActive
 	}
-	defaultArgs := []string{
-		"--github-source-org", m.SourceOrg,
-		"--github-target-org", m.TargetOrg,
+	err = ms.gitHubService.OrgPermissions(c, Target, run.TargetOrg)
+	if errors.Is(err, ErrTokenNotFound) {
+		return fmt.Errorf("%w: cancelling a run takes a target token that can migrate into %s", err, run.TargetOrg)
 	}
-	ghesUrl := os.Getenv("GITHUB_ENTERPRISE_SOURCE_URL")
-	if ghesUrl != "" {
-		defaultArgs = append(defaultArgs, "--ghes-api-url", fmt.Sprintf("%s/api/v3", ghesUrl))
+	if err != nil {
+		return err
+	}
+	queued := ms.queue.cancel(s, func(j *job) {
+		j.cancel()
+		activeJobs.Delete(s)
+		ms.emit(j, "migration cancelled before it started")
+		ms.cancelRun(s)
+	})
+	if queued != nil {
+		return nil
 	}
-	migrateScript := "migrate"
-	ghCLICmd := "gh"
-	// run `gh gei generate-script --github-source-org SOURCE_ORG --github-target-org TARGET_ORG --output FILE`
-	genScriptCmdArgs := []string{
-		"gei",
-		"generate-script",
-		"--output", migrateScript,
+	j, ok := activeJobs.Load(s)
+	if !ok {
+		if run.Status == RunScheduled {
+			return ms.unschedule(s)
+		}
+		return ms.cancelFollowed(run)
 	}
-	genScriptCmdArgs = append(genScriptCmdArgs, defaultArgs...)
-	genScriptCmd := exec.Command(ghCLICmd, genScriptCmdArgs...)
-	genScriptCmd.Env = runEnv
+	// the worker notices the cancellation once the killed command exits and takes care of the rest
+	return j.(*job).cancel()
+}
 
-	output, err := genScriptCmd.CombinedOutput()
+// cancelFollowed cancels a run the tracker is following, with no process left to kill: a queue-only run whose
+// commands have exited, or one orphaned by a restart. Its migrations are aborted with the credentials it saved.
+func (ms *MigratorServiceImpl) cancelFollowed(run RunRecord) error {
+	if run.RoleChange != nil || len(run.Reclaims) != 0 {
+		// run in the server's own goroutines, with nothing to abort
+		return ErrRunNotActive
+	}
+	ms.recordOutput(run.ID, "migration cancelled")
+	credentials, err := ms.runStore.Credentials(run.ID)
+	var targetToken string
+	if err == nil {
+		targetToken, err = ms.target.token(credentials, run.TargetOrg)
+	}
 	if err != nil {
-		return fmt.Errorf("error generating migration script: %w; output: %s", err, output)
+		ms.recordOutput(run.ID, fmt.Sprintf("unable to abort migrations: %v", err))
+		ms.cancelRun(run.ID)
+		return nil
 	}
-	if err = os.Chmod(migrateScript, 0755); err != nil {
-		return err
+	for _, repo := range run.Repos {
+		if repo.MigrationID == "" || repo.Done() {
+			continue
+		}
+		if err := ms.gitHubService.AbortMigration(targetToken, repo.MigrationID); err != nil {
+			ms.recordOutput(run.ID, err.Error())
+			continue
+		}
+		ms.recordOutput(run.ID, fmt.Sprintf("aborted migration %s", repo.MigrationID))
 	}
+	ms.cancelRun(run.ID)
+	return nil
+}
 
-	var runMigrationCmd *exec.Cmd
-	var runMigrationArgs []string
+func (ms *MigratorServiceImpl) worker() {
+	for {
+		ms.process(ms.queue.pop())
+	}
+}
 
-	if m.SourceRepo == "" {
-		// run migration script
-		runMigrationCmd = exec.Command(fmt.Sprintf("./%s", migrateScript))
-	} else {
-		// run single repo migration
-		runMigrationArgs = []string{
-			"gei",
-			"migrate-repo",
-			"--source-repo", m.SourceRepo,
-		}
-		runMigrationArgs = append(runMigrationArgs, defaultArgs...)
-		runMigrationCmd = exec.Command(ghCLICmd, runMigrationArgs...)
+// process runs a job to completion in its own working directory.
+func (ms *MigratorServiceImpl) process(j *job) {
+	runID := j.migration.OutputStreamName
+	defer activeJobs.Delete(runID)
+	if err := ms.runStore.StartRun(runID); err != nil {
+		log.Printf("error starting run %s: %v", runID, err)
 	}
-	runMigrationCmd.Env = runEnv
+	workDir, err := os.MkdirTemp("", "ghec-migrator-")
+	if err != nil {
+		ms.emit(j, fmt.Sprintf("error creating working directory: %v", err))
+		ms.finishRun(runID, -1)
+		return
+	}
+	defer os.RemoveAll(workDir)
 
-	stdoutPipe, err := runMigrationCmd.StdoutPipe()
+	if j.migration.DryRun {
+		ms.plan(j)
+		return
+	}
+
+	repos, err := ms.sourceRepos(j)
+	if err == nil {
+		err = j.migration.TargetNaming.Collisions(repos)
+	}
 	if err != nil {
-		return err
+		ms.emit(j, err.Error())
+		ms.finishRun(runID, -1)
+		return
+	}
+	if !ms.ready(j, repos) {
+		ms.finishRun(runID, -1)
+		return
+	}
+	j.repos.add(repos...)
+	ms.trackRepos(j, j.repos.statuses()...)
+	exitCode := ms.migrateRepos(j, repos, workDir)
+	if j.isCancelled() {
+		ms.abort(j)
+		return
+	}
+	if inFlight := j.repos.inFlight(); inFlight != 0 {
+		// the processes are gone but migrations they queued are still running on the target
+		ms.emit(j, fmt.Sprintf("%d repository migrations are still in progress, following them through the migration API", inFlight))
+		return
 	}
+	ms.finishRun(runID, exitCode)
+}
 
-	stderrPipe, err := runMigrationCmd.StderrPipe()
+// sourceRepos returns the repos a job migrates: the selected ones, or every repo in the source org.
+func (ms *MigratorServiceImpl) sourceRepos(j *job) ([]string, error) {
+	if len(j.migration.SourceRepos) != 0 {
+		return j.migration.SourceRepos, nil
+	}
+	repos, err := j.source.Repos(j.credentials.sourceToken(), j.migration.SourceOrg)
 	if err != nil {
-		return err
+		return nil, fmt.Errorf("error listing repos in %s: %w", j.migration.SourceOrg, err)
 	}
+	return repos, nil
+}
 
-	if err := runMigrationCmd.Start(); err != nil {
-		return err
+// migrateRepos migrates repos, up to ms.concurrency at a time, and returns the last non-zero exit code.
+// A failed repo doesn't stop the rest of the run, but the run as a whole is marked failed.
+func (ms *MigratorServiceImpl) migrateRepos(j *job, repos []string, workDir string) int {
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		exitCode int
+	)
+	slots := make(chan struct{}, ms.concurrency)
+	for _, repo := range repos {
+		slots <- struct{}{}
+		if j.isCancelled() {
+			break
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-slots }()
+			if code := ms.migrateRepo(j, repo, workDir); code != 0 {
+				mu.Lock()
+				exitCode = code
+				mu.Unlock()
+			}
+		}()
 	}
+	wg.Wait()
+	return exitCode
+}
 
-	ch := make(chan string, 10)
-	outputMap.Store(m.OutputStreamName, ch)
+// migrateRepo runs the source's migrate-repo for a single repo in a working directory of its own (GEI writes its logs there).
+func (ms *MigratorServiceImpl) migrateRepo(j *job, repo string, workDir string) int {
+	ms.trackRepos(j, j.repos.begin(repo))
+	cmd := ms.repoCommand(j, repo)
+	env, err := ms.migrationEnv(j)
+	if err != nil {
+		ms.emit(j, repoLine(repo, err.Error()))
+		ms.trackRepos(j, j.repos.exited(repo, -1))
+		return -1
+	}
+	cmd.Env = env
+	repoDir, err := os.MkdirTemp(workDir, "repo-")
+	if err != nil {
+		ms.emit(j, repoLine(repo, fmt.Sprintf("error creating working directory: %v", err)))
+		ms.trackRepos(j, j.repos.exited(repo, -1))
+		return -1
+	}
+	cmd.Dir = repoDir
+	code := ms.execute(j, repo, cmd, func(line string) {
+		if migrationID := migrationIDPattern.FindString(line); migrationID != "" {
+			j.trackMigration(migrationID)
+		}
+		if status, changed := j.repos.parse(repo, line); changed {
+			ms.trackRepos(j, status)
+		}
+	})
+	if j.isCancelled() {
+		return code
+	}
+	ms.emit(j, repoLine(repo, fmt.Sprintf("exited with status %d", code)))
+	ms.trackRepos(j, j.repos.exited(repo, code))
+	if j.repos.status(repo).State != RepoSucceeded {
+		return code
+	}
+	return ms.migrationSteps(j, repo, repoDir)
+}
 
-	go func() {
-		defer close(ch)
-		var wg sync.WaitGroup
+// migrationSteps runs the run's migration steps for a repo that has migrated, one after the other, and returns the last
+// non-zero exit code. A failed step doesn't stop the next one, the repo's alerts of each kind are migrated separately.
+func (ms *MigratorServiceImpl) migrationSteps(j *job, repo string, repoDir string) int {
+	exitCode := 0
+	for _, step := range j.migration.Options.Steps() {
+		if j.isCancelled() {
+			break
+		}
+		ms.trackRepos(j, j.repos.beginStep(repo, step))
+		cmd := j.source.StepCommand(j.migration, repo, step)
+		cmd.Args = append(cmd.Args, ms.target.args()...)
+		env, err := ms.migrationEnv(j)
+		if err != nil {
+			ms.emit(j, repoLine(repo, err.Error()))
+			ms.trackRepos(j, j.repos.stepExited(repo, step, -1, err.Error()))
+			exitCode = -1
+			continue
+		}
+		cmd.Env = env
+		cmd.Dir = repoDir
+		var lastError string
+		code := ms.execute(j, repo, cmd, func(line string) {
+			if m := errorLinePattern.FindStringSubmatch(line); m != nil {
+				lastError = m[1]
+			}
+		})
+		if j.isCancelled() {
+			break
+		}
+		ms.emit(j, repoLine(repo, fmt.Sprintf("%s exited with status %d", step.Name, code)))
+		ms.trackRepos(j, j.repos.stepExited(repo, step, code, lastError))
+		if code != 0 {
+			exitCode = code
+		}
+	}
+	return exitCode
+}
 
-		wg.Add(1)
-		go func(ch chan string, readPipe io.ReadCloser) {
-			defer wg.Done()
-			ms.collectOutput(ch, readPipe)
-		}(ch, stdoutPipe)
+// abort cleans up after a cancelled job by aborting the repository migrations it queued on the target.
+func (ms *MigratorServiceImpl) abort(j *job) {
+	ms.emit(j, "migration cancelled")
+	targetToken, err := ms.target.token(j.credentials, j.migration.TargetOrg)
+	if err != nil {
+		ms.emit(j, fmt.Sprintf("unable to abort migrations: %v", err))
+		ms.cancelRun(j.migration.OutputStreamName)
+		return
+	}
+	for _, migrationID := range j.trackedMigrations() {
+		// migrations that already finished can't be aborted, so errors are reported rather than treated as fatal
+		if err := ms.gitHubService.AbortMigration(targetToken, migrationID); err != nil {
+			ms.emit(j, err.Error())
+			continue
+		}
+		ms.emit(j, fmt.Sprintf("aborted migration %s", migrationID))
+	}
+	ms.cancelRun(j.migration.OutputStreamName)
+}
 
-		wg.Add(1)
-		go func(ch chan string, readPipe io.ReadCloser) {
-			defer wg.Done()
-			ms.collectOutput(ch, readPipe)
-		}(ch, stderrPipe)
+// repoCommand is the source's migrate-repo for a repo, pointed at the target.
+func (ms *MigratorServiceImpl) repoCommand(j *job, repo string) Command {
+	cmd := j.source.Command(j.migration, repo)
+	cmd.Args = append(cmd.Args, ms.target.args()...)
+	return cmd
+}
 
-		if err := runMigrationCmd.Wait(); err != nil {
-			log.Printf("command finished with error: %v", err)
+// migrationEnv passes the run's credentials to a repo's command. GitHub App installation tokens are minted per repo,
+// so a long run never hands a command one that's about to expire.
+func (ms *MigratorServiceImpl) migrationEnv(j *job) ([]string, error) {
+	credentials := j.credentials
+	targetToken, err := ms.target.token(credentials, j.migration.TargetOrg)
+	if err != nil {
+		return nil, err
+	}
+	credentials.TargetToken = targetToken
+	if credentials.SourceApp {
+		if j.source.App() == nil {
+			return nil, ErrAppNotConfigured
+		}
+		sourceToken, err := j.source.App().InstallationToken(j.migration.SourceOrg)
+		if err != nil {
+			return nil, err
 		}
+		credentials.SourceToken = sourceToken
+	}
+	return append(targetEnv(credentials.TargetToken), j.source.Env(credentials)...), nil
+}
 
-		wg.Wait()
-	}()
-	return nil
+// execute runs repo's cmd to completion, persisting and forwarding its output, and returns its exit code. Each line of
+// output is handed to parse once it's been emitted.
+func (ms *MigratorServiceImpl) execute(j *job, repo string, cmd Command, parse func(line string)) int {
+	return runCommand(ms.executor, cmd, func(line string) {
+		ms.emit(j, repoLine(repo, line))
+		parse(line)
+	}, j)
+}
+
+// emit records a line of job output, which is where the output poller reads it from.
+func (ms *MigratorServiceImpl) emit(j *job, line string) {
+	ms.recordOutput(j.migration.OutputStreamName, line)
 }
 
-func (*MigratorServiceImpl) collectOutput(ch chan string, readPipe io.ReadCloser) {
-	scanner := bufio.NewScanner(readPipe)
-	for scanner.Scan() {
-		ch <- scanner.Text()
+func (ms *MigratorServiceImpl) trackRepos(j *job, statuses ...RepoStatus) {
+	if len(statuses) == 0 {
+		return
 	}
-	if err := scanner.Err(); err != nil {
-		log.Printf("error reading pipe: %v", err)
+	if err := ms.runStore.SaveRepoStatuses(j.migration.OutputStreamName, statuses...); err != nil {
+		log.Printf("error recording repo status for run %s: %v", j.migration.OutputStreamName, err)
 	}
 }
 
-// Accepts an opaque string token and returns available output as slice of strings and whether output is done as a bool
-func (*MigratorServiceImpl) Output(s string) ([]string, bool, error) {
-	ch, ok := outputMap.Load(s)
-	if !ok {
-		return []string{}, false, fmt.Errorf("no stream found for name %s", s)
+func (ms *MigratorServiceImpl) recordOutput(runID string, lines ...string) {
+	if err := ms.runStore.AppendOutput(runID, lines...); err != nil {
+		log.Printf("error recording output for run %s: %v", runID, err)
 	}
-	var outputLines []string
-	for {
-		select {
-		case line, ok := <-ch.(chan string):
-			if !ok {
-				outputMap.Delete(s)
-				return outputLines, true, nil
-			}
-			outputLines = append(outputLines, line)
-		default:
-			return outputLines, false, nil
-		}
+}
+
+func (ms *MigratorServiceImpl) finishRun(runID string, exitCode int) {
+	if err := ms.runStore.FinishRun(runID, exitCode); err != nil {
+		log.Printf("error finishing run %s: %v", runID, err)
+	}
+}
+
+func (ms *MigratorServiceImpl) cancelRun(runID string) {
+	if err := ms.runStore.CancelRun(runID); err != nil {
+		log.Printf("error cancelling run %s: %v", runID, err)
 	}
 }
 
+// Accepts an opaque string token and the number of lines already seen, and returns the output since as slice of
+// strings and whether output is done as a bool. Output is read back from the run store, so nothing is held in memory
+// for runs nobody is watching, and a viewer arriving late (or after a restart) still sees all of it.
+func (ms *MigratorServiceImpl) Output(s string, from int) ([]string, bool, error) {
+	return ms.runStore.OutputFrom(s, from)
+}
+
 // generateStreamName generates a cryptographically secure random string for output streams.
 func generateStreamName() (string, error) {
 	b := make([]byte, 16)
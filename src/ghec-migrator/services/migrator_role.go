@@ -0,0 +1,191 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"regexp"
+	"slices"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+var ErrInvalidRoleChange = errors.New("invalid migrator role change")
+
+// actorPattern matches user logins and team slugs, which can't be mistaken for a flag of the command they're passed to.
+var actorPattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.-]*$`)
+
+type MigratorActorType string
+
+const (
+	UserActor MigratorActorType = "USER"
+	TeamActor MigratorActorType = "TEAM"
+)
+
+// MigratorRoleChange grants the migrator role on a target org to a user or team, or revokes it. Changes are recorded
+// as runs, RunRecord.TargetOrg being the org.
+type MigratorRoleChange struct {
+	Actor     string // user login or team slug
+	ActorType MigratorActorType
+	Revoke    bool
+}
+
+func (rc MigratorRoleChange) Validate() error {
+	if rc.Actor == "" {
+		return fmt.Errorf("%w: missing user or team", ErrInvalidRoleChange)
+	}
+	if !actorPattern.MatchString(rc.Actor) {
+		return fmt.Errorf("%w: %q isn't a user login or team slug", ErrInvalidRoleChange, rc.Actor)
+	}
+	if rc.ActorType != UserActor && rc.ActorType != TeamActor {
+		return fmt.Errorf("%w: actor type %q, expected %s or %s", ErrInvalidRoleChange, rc.ActorType, UserActor, TeamActor)
+	}
+	return nil
+}
+
+func (rc MigratorRoleChange) command() string {
+	if rc.Revoke {
+		return "revoke-migrator-role"
+	}
+	return "grant-migrator-role"
+}
+
+// MigratorRoleHolder is a user or team this server last granted the migrator role to. They may have lost it since, if
+// it was revoked some other way.
+type MigratorRoleHolder struct {
+	Actor     string
+	ActorType MigratorActorType
+	GrantedAt time.Time
+	RunID     string // the change that granted it
+}
+
+type MigratorRoleService interface {
+	// Holders lists who this server granted the migrator role on org to and the changes made to it, most recent first.
+	// GitHub has no API listing migrators, so this is only the server's own history: changes made some other way (the
+	// API, another tool) aren't known.
+	Holders(org string) ([]MigratorRoleHolder, []RunRecord, error)
+	// Change starts `gh gei grant-migrator-role` (or `revoke-migrator-role`) on org with the session's target token,
+	// recording it as a run, and returns the run's ID.
+	Change(c echo.Context, org string, change MigratorRoleChange) (string, error)
+}
+
+func NewMigratorRoleService(gitHubService GitHubService, target GitHubTarget, runStore RunStore, executor Executor) MigratorRoleService {
+	return &MigratorRoleServiceImpl{
+		gitHubService: gitHubService,
+		target:        target,
+		runStore:      runStore,
+		executor:      executor,
+	}
+}
+
+type MigratorRoleServiceImpl struct {
+	gitHubService GitHubService
+	target        GitHubTarget
+	runStore      RunStore
+	executor      Executor
+}
+
+func (mrs *MigratorRoleServiceImpl) Holders(org string) ([]MigratorRoleHolder, []RunRecord, error) {
+	runs, err := mrs.runStore.Runs()
+	if err != nil {
+		return nil, nil, err
+	}
+	var changes []RunRecord
+	for _, run := range runs {
+		if run.RoleChange != nil && run.TargetOrg == org {
+			changes = append(changes, run)
+		}
+	}
+	slices.SortFunc(changes, func(a, b RunRecord) int {
+		return b.QueuedAt.Compare(a.QueuedAt)
+	})
+	// the most recent successful change to each actor decides whether they hold the role
+	var holders []MigratorRoleHolder
+	seen := map[MigratorRoleHolder]bool{}
+	for _, run := range changes {
+		if run.Status != RunSucceeded {
+			continue
+		}
+		actor := MigratorRoleHolder{Actor: run.RoleChange.Actor, ActorType: run.RoleChange.ActorType}
+		if seen[actor] {
+			continue
+		}
+		seen[actor] = true
+		if !run.RoleChange.Revoke {
+			holders = append(holders, MigratorRoleHolder{
+				Actor:     actor.Actor,
+				ActorType: actor.ActorType,
+				GrantedAt: run.FinishedAt,
+				RunID:     run.ID,
+			})
+		}
+	}
+	return holders, changes, nil
+}
+
+func (mrs *MigratorRoleServiceImpl) Change(c echo.Context, org string, change MigratorRoleChange) (string, error) {
+	if org == "" {
+		return "", fmt.Errorf("%w: missing org", ErrInvalidRoleChange)
+	}
+	if err := change.Validate(); err != nil {
+		return "", err
+	}
+	token, err := mrs.gitHubService.Token(c, Target)
+	if err != nil {
+		return "", err
+	}
+	if token.App {
+		// the installation can change anyone's role, so its user has to be allowed to
+		if err := mrs.gitHubService.OrgPermissions(c, Target, org); err != nil {
+			return "", err
+		}
+	}
+	targetToken, err := mrs.target.token(Credentials{TargetToken: token.PersonalAccess, TargetApp: token.App}, org)
+	if rejected(err) {
+		// e.g. the app isn't installed on org
+		return "", fmt.Errorf("%w: %w", ErrInvalidRoleChange, err)
+	}
+	if err != nil {
+		return "", err
+	}
+	id, err := generateStreamName()
+	if err != nil {
+		return "", err
+	}
+	record := RunRecord{
+		ID:         id,
+		TargetOrg:  org,
+		RoleChange: &change,
+		QueuedAt:   time.Now(),
+	}
+	if err := mrs.runStore.CreateRun(record); err != nil {
+		return "", fmt.Errorf("error recording run: %w", err)
+	}
+	if err := mrs.runStore.StartRun(id); err != nil {
+		return "", fmt.Errorf("error recording run: %w", err)
+	}
+	args := []string{
+		"gei",
+		change.command(),
+		"--github-org", org,
+		"--actor", change.Actor,
+		"--actor-type", string(change.ActorType),
+	}
+	cmd := Command{
+		Args: append(args, mrs.target.args()...),
+		Env:  targetEnv(targetToken),
+	}
+	// gh takes a while to start and GEI retries failed calls, more than a request should wait on
+	go func() {
+		exitCode := runCommand(mrs.executor, cmd, func(line string) {
+			if err := mrs.runStore.AppendOutput(id, line); err != nil {
+				log.Printf("error recording output for run %s: %v", id, err)
+			}
+		}, nil)
+		if err := mrs.runStore.FinishRun(id, exitCode); err != nil {
+			log.Printf("error finishing run %s: %v", id, err)
+		}
+	}()
+	return id, nil
+}
@@ -0,0 +1,118 @@
+package services
+
+import (
+	"errors"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestMigratorRoleChanges(t *testing.T) {
+	ts := newTestService(t, 1, 5)
+	ts.executor.Scripts["grant-migrator-role"] = MigratorRoleChanged(false)
+	ts.executor.Scripts["revoke-migrator-role"] = MigratorRoleChanged(true)
+	mrs := NewMigratorRoleService(ts.github, GitHubTarget{URL: "https://acme-eu.ghe.com"}, ts.store, ts.executor)
+
+	for _, change := range []MigratorRoleChange{
+		{Actor: "octocat", ActorType: UserActor},
+		{Actor: "platform", ActorType: TeamActor},
+		{Actor: "octocat", ActorType: UserActor, Revoke: true},
+	} {
+		id, err := mrs.Change(nil, "target-org", change)
+		if err != nil {
+			t.Fatal(err)
+		}
+		run := ts.waitForFinish(t, id)
+		if run.Status != RunSucceeded || run.RoleChange == nil || *run.RoleChange != change {
+			t.Errorf("got run %+v for %+v", run, change)
+		}
+		if !containsLine(run.Output, "Successfully") {
+			t.Errorf("output wasn't recorded, got %v", run.Output)
+		}
+	}
+
+	commands := ts.executor.Commands()
+	if len(commands) != 3 {
+		t.Fatalf("got %d commands, want 3", len(commands))
+	}
+	want := []string{"gei", "grant-migrator-role", "--github-org", "target-org", "--actor", "octocat", "--actor-type", "USER", "--target-api-url", "https://api.acme-eu.ghe.com"}
+	if !slices.Equal(commands[0].Args, want) {
+		t.Errorf("got args %v, want %v", commands[0].Args, want)
+	}
+	if !slices.Contains(commands[0].Env, "GH_PAT=target-token") {
+		t.Errorf("token missing from env %v", commands[0].Env)
+	}
+	if commands[2].Args[1] != "revoke-migrator-role" {
+		t.Errorf("got %v, want a revoke", commands[2].Args)
+	}
+
+	holders, changes, err := mrs.Holders("target-org")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(holders) != 1 || holders[0].Actor != "platform" || holders[0].ActorType != TeamActor {
+		t.Errorf("got holders %+v, want the platform team", holders)
+	}
+	if len(changes) != 3 || !changes[0].RoleChange.Revoke {
+		t.Errorf("got %d changes, want 3 with the revoke first", len(changes))
+	}
+}
+
+func TestMigratorRoleChangeStreamsOutput(t *testing.T) {
+	ts := newTestService(t, 1, 5)
+	ts.executor.Scripts["grant-migrator-role"] = FakeScript{
+		Lines: []FakeLine{
+			{0, "[INFO] Granting migrator role ..."},
+			{time.Second, "[INFO] Successfully granted the migrator role to {actor}"},
+		},
+	}
+	mrs := NewMigratorRoleService(ts.github, GitHubTarget{}, ts.store, ts.executor)
+
+	id, err := mrs.Change(nil, "target-org", MigratorRoleChange{Actor: "octocat", ActorType: UserActor})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// shown while GEI is still working on it, not once it's done
+	run := ts.waitFor(t, id, func(r RunRecord) bool { return containsLine(r.Output, "Granting migrator role") })
+	if run.Finished() {
+		t.Errorf("got status %s, want the output before it finished", run.Status)
+	}
+	ts.waitForFinish(t, id)
+}
+
+func TestMigratorRoleChangeFails(t *testing.T) {
+	ts := newTestService(t, 1, 5)
+	ts.executor.Scripts["grant-migrator-role"] = FakeScript{
+		Lines:    []FakeLine{{0, "[ERROR] Target Org Id must be provided when granting the migrator role"}},
+		ExitCode: 1,
+	}
+	mrs := NewMigratorRoleService(ts.github, GitHubTarget{}, ts.store, ts.executor)
+
+	id, err := mrs.Change(nil, "target-org", MigratorRoleChange{Actor: "octocat", ActorType: UserActor})
+	if err != nil {
+		t.Fatal(err)
+	}
+	run := ts.waitForFinish(t, id)
+	if run.Status != RunFailed || run.ExitCode != 1 {
+		t.Errorf("got status %s exit code %d, want failed with 1", run.Status, run.ExitCode)
+	}
+	if holders, _, _ := mrs.Holders("target-org"); len(holders) != 0 {
+		t.Errorf("got holders %+v after a failed grant", holders)
+	}
+	for _, change := range []MigratorRoleChange{
+		{Actor: "octocat", ActorType: "ROBOT"},
+		{Actor: "--github-org=other-org", ActorType: UserActor},
+	} {
+		if _, err := mrs.Change(nil, "target-org", change); !errors.Is(err, ErrInvalidRoleChange) {
+			t.Errorf("got %v for %+v, want ErrInvalidRoleChange", err, change)
+		}
+	}
+
+	// the API refusing the token is the user's to fix too
+	app := newTestApp(t)
+	ts.tokens.target = Token{Type: Target, App: true, Admin: true}
+	mrs = NewMigratorRoleService(ts.github, GitHubTarget{App: app.GitHubApp}, ts.store, ts.executor)
+	if _, err := mrs.Change(nil, "uninstalled-org", MigratorRoleChange{Actor: "octocat", ActorType: UserActor}); !errors.Is(err, ErrInvalidRoleChange) {
+		t.Errorf("got %v, want ErrInvalidRoleChange", err)
+	}
+}
@@ -0,0 +1,871 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/securecookie"
+	"github.com/labstack/echo/v4"
+)
+
+type fakeGitHubService struct {
+	tokens         TokenService
+	orgRepos       map[string][]string
+	orgReposErr    error
+	permissionsErr map[string]error // by org
+	mannequins     []Mannequin
+	members        []OrgMember
+	repoFacts      map[string]RepoFacts // by source repo, zero for any other
+	migrations     []RepositoryMigration
+	targetRepos    []string
+
+	mu      sync.Mutex
+	aborted []string
+}
+
+func (gs *fakeGitHubService) Token(c echo.Context, t ClientType) (Token, error) {
+	return gs.tokens.Token(c, t)
+}
+
+func (gs *fakeGitHubService) Orgs(c echo.Context, t ClientType) ([]string, error) {
+	return nil, nil
+}
+
+func (gs *fakeGitHubService) SourceOrgs(sourceURL string, sourceToken string) ([]string, error) {
+	return nil, nil
+}
+
+func (gs *fakeGitHubService) OrgRepos(sourceURL string, sourceToken string, org string) ([]string, error) {
+	return gs.orgRepos[org], gs.orgReposErr
+}
+
+func (gs *fakeGitHubService) Scopes(c echo.Context, t ClientType) ([]string, error) {
+	return requiredScopes, nil
+}
+
+func (gs *fakeGitHubService) SourceScopes(sourceURL string, sourceToken string) ([]string, error) {
+	return requiredScopes, nil
+}
+
+func (gs *fakeGitHubService) OrgPermissions(c echo.Context, t ClientType, org string) error {
+	return gs.permissionsErr[org]
+}
+
+func (gs *fakeGitHubService) SourceOrgPermissions(sourceURL string, sourceToken string, org string) error {
+	return gs.permissionsErr[org]
+}
+
+func (gs *fakeGitHubService) AbortMigration(targetToken string, migrationID string) error {
+	gs.mu.Lock()
+	defer gs.mu.Unlock()
+	gs.aborted = append(gs.aborted, migrationID)
+	return nil
+}
+
+func (gs *fakeGitHubService) RepositoryMigrations(targetToken string, migrationIDs []string) ([]RepositoryMigration, error) {
+	var migrations []RepositoryMigration
+	for _, migration := range gs.migrations {
+		if slices.Contains(migrationIDs, migration.ID) {
+			migrations = append(migrations, migration)
+		}
+	}
+	return migrations, nil
+}
+
+func (gs *fakeGitHubService) Mannequins(targetToken string, org string) ([]Mannequin, error) {
+	return gs.mannequins, nil
+}
+
+func (gs *fakeGitHubService) OrgMembers(targetToken string, org string) ([]OrgMember, error) {
+	return gs.members, nil
+}
+
+func (gs *fakeGitHubService) SourceRepo(sourceURL string, sourceToken string, org string, repo string) (RepoFacts, error) {
+	return gs.repoFacts[repo], nil
+}
+
+func (gs *fakeGitHubService) RepoExists(targetToken string, org string, repo string) (bool, error) {
+	return slices.Contains(gs.targetRepos, repo), nil
+}
+
+func (gs *fakeGitHubService) abortedMigrations() []string {
+	gs.mu.Lock()
+	defer gs.mu.Unlock()
+	return slices.Clone(gs.aborted)
+}
+
+// fakeTokenService is a session holding a token for each side.
+type fakeTokenService struct {
+	source Token
+	target Token
+}
+
+func (ts *fakeTokenService) ClearSession(c echo.Context) {}
+
+func (ts *fakeTokenService) StoreToken(c echo.Context, t Token) error {
+	return nil
+}
+
+func (ts *fakeTokenService) StoreOAuthState(c echo.Context, s OAuthState) error {
+	return nil
+}
+
+func (ts *fakeTokenService) TakeOAuthState(c echo.Context) (OAuthState, error) {
+	return OAuthState{}, ErrOAuthState
+}
+
+func (ts *fakeTokenService) Token(c echo.Context, t ClientType) (Token, error) {
+	if t == Source {
+		return ts.source, nil
+	}
+	return ts.target, nil
+}
+
+type testService struct {
+	*MigratorServiceImpl
+	github   *fakeGitHubService
+	tokens   *fakeTokenService
+	executor *FakeExecutor
+	store    RunStore
+}
+
+func newTestService(t *testing.T, workers int, concurrency int) *testService {
+	t.Helper()
+	store, err := NewRunStore(filepath.Join(t.TempDir(), "runs.db"), securecookie.New(securecookie.GenerateRandomKey(32), securecookie.GenerateRandomKey(32)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	executor := NewFakeExecutor(MigrationSucceeds(1, time.Millisecond))
+	tokens := &fakeTokenService{
+		source: Token{PersonalAccess: "source-token", Type: Source},
+		target: Token{PersonalAccess: "target-token", Type: Target},
+	}
+	gs := &fakeGitHubService{tokens: tokens, orgRepos: map[string][]string{}}
+	ss := NewSourceService(tokens,
+		NewGitHubSource(gs, GitHubInstance{}),
+		NewGitHubSource(gs, GitHubInstance{Name: "ghes-west", URL: "https://ghes-west.example.com/"}),
+		NewAzureDevOpsSource(),
+		NewBitbucketServerSource("https://bitbucket.example.com"),
+	)
+	ms := NewMigratorService(gs, ss, GitHubTarget{}, store, executor, workers, concurrency).(*MigratorServiceImpl)
+	return &testService{MigratorServiceImpl: ms, github: gs, tokens: tokens, executor: executor, store: store}
+}
+
+func (ts *testService) run(t *testing.T, m Migration) string {
+	t.Helper()
+	if m.SourceOrg == "" {
+		m.SourceOrg = "source-org"
+	}
+	if m.TargetOrg == "" {
+		m.TargetOrg = "target-org"
+	}
+	id, err := ts.Run(m)
+	if err != nil {
+		t.Fatalf("error starting run: %v", err)
+	}
+	return id
+}
+
+// waitFor polls the run until done returns true or the test times out.
+func (ts *testService) waitFor(t *testing.T, id string, done func(RunRecord) bool) RunRecord {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		run, err := ts.store.Run(id)
+		if err != nil {
+			t.Fatalf("error loading run: %v", err)
+		}
+		if done(run) {
+			return run
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for run, status %s, repos %+v", run.Status, run.Repos)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func (ts *testService) waitForFinish(t *testing.T, id string) RunRecord {
+	t.Helper()
+	return ts.waitFor(t, id, RunRecord.Finished)
+}
+
+func repoStatus(t *testing.T, run RunRecord, repo string) RepoStatus {
+	t.Helper()
+	i := slices.IndexFunc(run.Repos, func(s RepoStatus) bool { return s.Repo == repo })
+	if i == -1 {
+		t.Fatalf("repo %s not tracked, got %+v", repo, run.Repos)
+	}
+	return run.Repos[i]
+}
+
+func containsLine(lines []string, substr string) bool {
+	return slices.ContainsFunc(lines, func(line string) bool { return strings.Contains(line, substr) })
+}
+
+func TestRunMigratesSelectedRepos(t *testing.T) {
+	ts := newTestService(t, 1, 5)
+
+	id := ts.run(t, Migration{SourceRepos: []string{"alpha", "beta"}})
+	run := ts.waitForFinish(t, id)
+
+	if run.Status != RunSucceeded || run.ExitCode != 0 {
+		t.Errorf("got status %s exit code %d, want succeeded with 0", run.Status, run.ExitCode)
+	}
+	for _, repo := range []string{"alpha", "beta"} {
+		status := repoStatus(t, run, repo)
+		if status.State != RepoSucceeded {
+			t.Errorf("%s: got state %s, want succeeded", repo, status.State)
+		}
+		if !strings.HasPrefix(status.MigrationID, "RM_") {
+			t.Errorf("%s: got migration ID %q", repo, status.MigrationID)
+		}
+		if status.ExitCode == nil || *status.ExitCode != 0 {
+			t.Errorf("%s: got exit code %v, want 0", repo, status.ExitCode)
+		}
+	}
+	commands := ts.executor.Commands()
+	if len(commands) != 2 {
+		t.Fatalf("got %d commands, want 2", len(commands))
+	}
+	for _, cmd := range commands {
+		args := commandArgs(cmd)
+		if args["--github-source-org"] != "source-org" || args["--github-target-org"] != "target-org" {
+			t.Errorf("got args %v", cmd.Args)
+		}
+		if !slices.Contains(cmd.Env, "GH_SOURCE_PAT=source-token") || !slices.Contains(cmd.Env, "GH_PAT=target-token") {
+			t.Errorf("tokens missing from env %v", cmd.Env)
+		}
+	}
+	if !containsLine(run.Output, "[alpha] [INFO] Migration completed") {
+		t.Errorf("output wasn't recorded, got %v", run.Output)
+	}
+}
+
+func TestRunFollowsSessionSourceInstance(t *testing.T) {
+	ts := newTestService(t, 1, 5)
+	ts.tokens.source = Token{PersonalAccess: "source-token", Type: Source, SourceKind: GitHubSource, SourceInstance: "ghes-west"}
+
+	id := ts.run(t, Migration{SourceRepos: []string{"alpha"}})
+	run := ts.waitForFinish(t, id)
+
+	if run.Source != GitHubSource || run.SourceInstance != "ghes-west" {
+		t.Errorf("got source %q instance %q, want github ghes-west", run.Source, run.SourceInstance)
+	}
+	commands := ts.executor.Commands()
+	if len(commands) != 1 {
+		t.Fatalf("got %d commands, want 1", len(commands))
+	}
+	if got := commandArgs(commands[0])["--ghes-api-url"]; got != "https://ghes-west.example.com/api/v3" {
+		t.Errorf("got --ghes-api-url %q", got)
+	}
+
+	// a retry has to come from the same instance
+	ts.tokens.source = Token{PersonalAccess: "source-token", Type: Source}
+	if _, err := ts.Run(Migration{SourceOrg: "source-org", TargetOrg: "target-org", Source: GitHubSource, SourceInstance: "ghes-west"}); !errors.Is(err, ErrSourceMismatch) {
+		t.Errorf("got %v, want ErrSourceMismatch", err)
+	}
+}
+
+func TestRunTargetsGHEComTenant(t *testing.T) {
+	ts := newTestService(t, 1, 5)
+	ts.target = GitHubTarget{URL: "https://acme-eu.ghe.com"}
+
+	id := ts.run(t, Migration{SourceRepos: []string{"alpha"}})
+	ts.waitForFinish(t, id)
+
+	commands := ts.executor.Commands()
+	if len(commands) != 1 {
+		t.Fatalf("got %d commands, want 1", len(commands))
+	}
+	if got := commandArgs(commands[0])["--target-api-url"]; got != "https://api.acme-eu.ghe.com" {
+		t.Errorf("got --target-api-url %q", got)
+	}
+}
+
+func TestRunAuthenticatesAsGitHubApps(t *testing.T) {
+	ts := newTestService(t, 1, 5)
+	sourceApp, targetApp := newTestApp(t), newTestApp(t)
+	ts.sourceService = NewSourceService(ts.tokens, NewGitHubSource(ts.github, GitHubInstance{App: sourceApp.GitHubApp}))
+	ts.target = GitHubTarget{App: targetApp.GitHubApp}
+	ts.tokens.source = Token{Type: Source, App: true, Admin: true}
+	ts.tokens.target = Token{Type: Target, App: true, Admin: true}
+	ts.executor.Default = MigrationQueued()
+
+	id := ts.run(t, Migration{SourceRepos: []string{"alpha", "beta"}})
+	run := ts.waitFor(t, id, func(r RunRecord) bool {
+		return containsLine(r.Output, "following them through the migration API")
+	})
+
+	// GEI can't be handed a fresh token while it waits, so the tracker follows the migrations instead
+	if !run.Options.QueueOnly {
+		t.Error("run authenticating as a GitHub App wasn't queue-only")
+	}
+	for _, cmd := range ts.executor.Commands() {
+		if !slices.Contains(cmd.Env, "GH_SOURCE_PAT=ghs_1_1") || !slices.Contains(cmd.Env, "GH_PAT=ghs_2_1") {
+			t.Errorf("installation tokens missing from env %v", cmd.Env)
+		}
+	}
+	credentials, err := ts.store.Credentials(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if credentials.SourceToken != "" || credentials.TargetToken != "" || !credentials.SourceApp || !credentials.TargetApp {
+		t.Errorf("got credentials %+v, want apps and no tokens", credentials)
+	}
+}
+
+func TestRunRejectsMissingPermissions(t *testing.T) {
+	ts := newTestService(t, 1, 5)
+	ts.github.permissionsErr = map[string]error{"target-org": fmt.Errorf("%w: Administration (organization) on target-org", ErrMissingPermission)}
+
+	if _, err := ts.Run(Migration{SourceOrg: "source-org", TargetOrg: "target-org"}); !errors.Is(err, ErrMissingPermission) {
+		t.Errorf("got %v, want ErrMissingPermission", err)
+	}
+	if commands := ts.executor.Commands(); len(commands) != 0 {
+		t.Errorf("got %d commands, want none", len(commands))
+	}
+}
+
+func TestRunMigratesFromAzureDevOps(t *testing.T) {
+	ts := newTestService(t, 1, 5)
+	ts.tokens.source = Token{PersonalAccess: "ado-pat", Type: Source, SourceKind: AzureDevOpsSource}
+
+	id := ts.run(t, Migration{
+		SourceOrg:    "contoso/Web Apps",
+		SourceRepos:  []string{"site"},
+		TargetNaming: TargetNaming{Prefix: "web-"},
+	})
+	run := ts.waitForFinish(t, id)
+
+	if run.Status != RunSucceeded || run.Source != AzureDevOpsSource {
+		t.Errorf("got status %s from source %q, want succeeded from ado", run.Status, run.Source)
+	}
+	commands := ts.executor.Commands()
+	if len(commands) != 1 {
+		t.Fatalf("got %d commands, want 1", len(commands))
+	}
+	cmd := commands[0]
+	want := []string{"ado2gh", "migrate-repo", "--ado-org", "contoso", "--ado-team-project", "Web Apps", "--ado-repo", "site", "--github-org", "target-org", "--github-repo", "web-site"}
+	if !slices.Equal(cmd.Args, want) {
+		t.Errorf("got args %v, want %v", cmd.Args, want)
+	}
+	if !slices.Contains(cmd.Env, "ADO_PAT=ado-pat") || !slices.Contains(cmd.Env, "GH_PAT=target-token") {
+		t.Errorf("tokens missing from env %v", cmd.Env)
+	}
+	if status := repoStatus(t, run, "site"); status.State != RepoSucceeded || status.TargetRepo != "web-site" {
+		t.Errorf("got %+v, want site migrated to web-site", status)
+	}
+}
+
+func TestRunRejectsOptionsTheSourceLacks(t *testing.T) {
+	ts := newTestService(t, 1, 5)
+	ts.tokens.source = Token{PersonalAccess: "ado-pat", Type: Source, SourceKind: AzureDevOpsSource}
+
+	_, err := ts.Run(Migration{SourceOrg: "contoso/Web Apps", TargetOrg: "target-org", Options: MigrationOptions{LockSource: true}})
+	if !errors.Is(err, ErrUnsupportedOption) {
+		t.Errorf("got %v, want ErrUnsupportedOption", err)
+	}
+}
+
+func TestRunStreamsOutput(t *testing.T) {
+	ts := newTestService(t, 1, 1)
+	ts.executor.Default = MigrationSucceeds(3, 5*time.Millisecond)
+
+	id := ts.run(t, Migration{SourceRepos: []string{"alpha"}})
+
+	var lines []string
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		output, done, err := ts.Output(id, len(lines))
+		if err != nil {
+			t.Fatalf("error polling output: %v", err)
+		}
+		lines = append(lines, output...)
+		if done {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("timed out polling output")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	run := ts.waitForFinish(t, id)
+	if !slices.Equal(lines, run.Output) {
+		t.Errorf("streamed output doesn't match recorded output:\n%v\n%v", lines, run.Output)
+	}
+	if !containsLine(lines, "State: IN_PROGRESS") || !containsLine(lines, "State: SUCCEEDED") {
+		t.Errorf("got %v", lines)
+	}
+	// a viewer arriving after the run finished still gets all of it
+	late, done, err := ts.Output(id, 0)
+	if err != nil || !done || !slices.Equal(late, run.Output) {
+		t.Errorf("got %v, %v, %v for a late viewer, want the recorded output", late, done, err)
+	}
+	if _, _, err := ts.Output("no-such-run", 0); !errors.Is(err, ErrRunNotFound) {
+		t.Errorf("got %v, want ErrRunNotFound", err)
+	}
+}
+
+func TestRunFailedRepo(t *testing.T) {
+	ts := newTestService(t, 1, 5)
+	ts.executor.Scripts["beta"] = MigrationFails(1, time.Millisecond, "Repository beta has blobs larger than 2 GiB")
+
+	id := ts.run(t, Migration{SourceRepos: []string{"alpha", "beta"}})
+	run := ts.waitForFinish(t, id)
+
+	if run.Status != RunFailed || run.ExitCode != 1 {
+		t.Errorf("got status %s exit code %d, want failed with 1", run.Status, run.ExitCode)
+	}
+	if status := repoStatus(t, run, "alpha"); status.State != RepoSucceeded {
+		t.Errorf("alpha: got state %s, want succeeded", status.State)
+	}
+	status := repoStatus(t, run, "beta")
+	if status.State != RepoFailed {
+		t.Errorf("beta: got state %s, want failed", status.State)
+	}
+	if status.Error != "Repository beta has blobs larger than 2 GiB" {
+		t.Errorf("beta: got error %q", status.Error)
+	}
+	if !slices.Equal(run.FailedRepos(), []string{"beta"}) {
+		t.Errorf("got failed repos %v", run.FailedRepos())
+	}
+}
+
+func TestRunMigratesAlerts(t *testing.T) {
+	ts := newTestService(t, 1, 5)
+	ts.executor.Scripts["migrate-code-scanning-alerts"] = AlertsMigrated(CodeScanningAlertsStep)
+	ts.executor.Scripts["migrate-secret-alerts"] = AlertsMigrated(SecretAlertsStep)
+	ts.executor.Scripts["migrate-secret-alerts beta"] = FakeScript{
+		Lines:    []FakeLine{{0, "[ERROR] Secret scanning is not enabled for target-org/beta"}},
+		ExitCode: 1,
+	}
+	ts.executor.Scripts["gamma"] = MigrationFails(0, time.Millisecond, "boom")
+
+	id := ts.run(t, Migration{
+		SourceRepos:  []string{"alpha", "beta", "gamma"},
+		TargetNaming: TargetNaming{Prefix: "platform-"},
+		Options:      MigrationOptions{MigrateCodeScanningAlerts: true, MigrateSecretAlerts: true},
+	})
+	run := ts.waitForFinish(t, id)
+
+	if run.Status != RunFailed {
+		t.Errorf("got status %s, want failed for beta's secret alerts", run.Status)
+	}
+	var alphaCommands [][]string
+	for _, cmd := range ts.executor.Commands() {
+		if slices.Contains(cmd.Args, "alpha") {
+			alphaCommands = append(alphaCommands, cmd.Args)
+		}
+		if slices.Contains(cmd.Args, "gamma") && cmd.Args[1] != "migrate-repo" {
+			t.Errorf("gamma didn't migrate, but ran %v", cmd.Args)
+		}
+	}
+	want := []string{"gei", "migrate-code-scanning-alerts", "--source-org", "source-org", "--source-repo", "alpha", "--target-org", "target-org", "--target-repo", "platform-alpha"}
+	if len(alphaCommands) != 3 || !slices.Equal(alphaCommands[1], want) || alphaCommands[2][1] != "migrate-secret-alerts" {
+		t.Errorf("got commands %v for alpha, want migrate-repo then %v then secret alerts", alphaCommands, want)
+	}
+
+	stepStates := func(repo string) []RepoState {
+		var states []RepoState
+		for _, step := range repoStatus(t, run, repo).Steps {
+			states = append(states, step.State)
+		}
+		return states
+	}
+	if states := stepStates("alpha"); !slices.Equal(states, []RepoState{RepoSucceeded, RepoSucceeded}) {
+		t.Errorf("alpha: got step states %v", states)
+	}
+	if states := stepStates("beta"); !slices.Equal(states, []RepoState{RepoSucceeded, RepoFailed}) {
+		t.Errorf("beta: got step states %v", states)
+	}
+	if status := repoStatus(t, run, "beta"); status.State != RepoSucceeded || status.Steps[1].Error != "Secret scanning is not enabled for target-org/beta" {
+		t.Errorf("beta: got %+v, want migrated with its secret alerts failed", status)
+	}
+	if states := stepStates("gamma"); !slices.Equal(states, []RepoState{RepoPending, RepoPending}) {
+		t.Errorf("gamma: got step states %v", states)
+	}
+	if !containsLine(RepoOutput(run.Output, "alpha"), "code scanning alerts migrated") {
+		t.Errorf("alpha's alerts output wasn't recorded, got %v", run.Output)
+	}
+}
+
+func TestRunRejectsUnsupportedAlertMigration(t *testing.T) {
+	ts := newTestService(t, 1, 5)
+	_, err := ts.Run(Migration{SourceOrg: "source-org", TargetOrg: "target-org", Options: MigrationOptions{QueueOnly: true, MigrateSecretAlerts: true}})
+	if !errors.Is(err, ErrUnsupportedOption) {
+		t.Errorf("queue only: got %v, want ErrUnsupportedOption", err)
+	}
+
+	ts.tokens.source = Token{PersonalAccess: "ado-pat", Type: Source, SourceKind: AzureDevOpsSource}
+	_, err = ts.Run(Migration{SourceOrg: "contoso/Web Apps", TargetOrg: "target-org", Options: MigrationOptions{MigrateCodeScanningAlerts: true}})
+	if !errors.Is(err, ErrUnsupportedOption) {
+		t.Errorf("Azure DevOps: got %v, want ErrUnsupportedOption", err)
+	}
+}
+
+func TestRunCommandStartFails(t *testing.T) {
+	ts := newTestService(t, 1, 1)
+	ts.executor.Default = FakeScript{StartErr: errors.New("gh: executable file not found in $PATH")}
+
+	id := ts.run(t, Migration{SourceRepos: []string{"alpha"}})
+	run := ts.waitForFinish(t, id)
+
+	if run.Status != RunFailed || run.ExitCode != -1 {
+		t.Errorf("got status %s exit code %d, want failed with -1", run.Status, run.ExitCode)
+	}
+	if status := repoStatus(t, run, "alpha"); status.State != RepoFailed {
+		t.Errorf("got state %s, want failed", status.State)
+	}
+	if !containsLine(run.Output, "executable file not found") {
+		t.Errorf("start error wasn't recorded, got %v", run.Output)
+	}
+}
+
+func TestRunWholeOrg(t *testing.T) {
+	ts := newTestService(t, 1, 5)
+	ts.github.orgRepos["source-org"] = []string{"alpha", "beta", "gamma"}
+
+	id := ts.run(t, Migration{TargetNaming: TargetNaming{Prefix: "team-"}})
+	run := ts.waitForFinish(t, id)
+
+	if run.Status != RunSucceeded {
+		t.Errorf("got status %s, want succeeded", run.Status)
+	}
+	var targets []string
+	for _, cmd := range ts.executor.Commands() {
+		targets = append(targets, commandArgs(cmd)["--target-repo"])
+	}
+	slices.Sort(targets)
+	if want := []string{"team-alpha", "team-beta", "team-gamma"}; !slices.Equal(targets, want) {
+		t.Errorf("got target repos %v, want %v", targets, want)
+	}
+	if len(run.Repos) != 3 {
+		t.Errorf("got %d repos tracked, want 3", len(run.Repos))
+	}
+}
+
+func TestRunWholeOrgListingFails(t *testing.T) {
+	ts := newTestService(t, 1, 5)
+	ts.github.orgReposErr = errors.New("401 Bad credentials")
+
+	for _, dryRun := range []bool{false, true} {
+		id := ts.run(t, Migration{DryRun: dryRun})
+		run := ts.waitForFinish(t, id)
+
+		if run.Status != RunFailed {
+			t.Errorf("got status %s, want failed", run.Status)
+		}
+		if !containsLine(run.Output, "401 Bad credentials") {
+			t.Errorf("got output %v", run.Output)
+		}
+	}
+	if len(ts.executor.Commands()) != 0 {
+		t.Error("no repos should have been migrated")
+	}
+}
+
+func TestRunRejectsTargetNameCollisions(t *testing.T) {
+	ts := newTestService(t, 1, 5)
+
+	_, err := ts.Run(Migration{
+		SourceOrg:    "source-org",
+		SourceRepos:  []string{"alpha", "beta"},
+		TargetOrg:    "target-org",
+		TargetNaming: TargetNaming{Names: map[string]string{"alpha": "beta"}},
+	})
+	if !errors.Is(err, ErrTargetNameCollision) {
+		t.Errorf("got %v, want ErrTargetNameCollision", err)
+	}
+}
+
+func TestRunConcurrencyLimit(t *testing.T) {
+	ts := newTestService(t, 1, 2)
+	ts.executor.Default = MigrationSucceeds(2, 10*time.Millisecond)
+
+	id := ts.run(t, Migration{SourceRepos: []string{"a", "b", "c", "d", "e"}})
+	run := ts.waitForFinish(t, id)
+
+	if run.Status != RunSucceeded {
+		t.Errorf("got status %s, want succeeded", run.Status)
+	}
+	if got := ts.executor.MaxRunning(); got != 2 {
+		t.Errorf("got %d repos migrating at once, want 2", got)
+	}
+}
+
+func TestQueueOnlyRunIsHandedToTracker(t *testing.T) {
+	ts := newTestService(t, 1, 5)
+	ts.executor.Default = MigrationQueued()
+
+	id := ts.run(t, Migration{SourceRepos: []string{"alpha"}, Options: MigrationOptions{QueueOnly: true}})
+	run := ts.waitFor(t, id, func(r RunRecord) bool {
+		return containsLine(r.Output, "following them through the migration API")
+	})
+
+	if run.Status != RunRunning {
+		t.Errorf("got status %s, want running", run.Status)
+	}
+	if status := repoStatus(t, run, "alpha"); status.State != RepoQueued {
+		t.Errorf("got state %s, want queued", status.State)
+	}
+}
+
+func TestCancelRunningMigration(t *testing.T) {
+	ts := newTestService(t, 1, 5)
+	ts.executor.Default = MigrationSucceeds(1000, 10*time.Millisecond)
+
+	id := ts.run(t, Migration{SourceRepos: []string{"alpha"}})
+	run := ts.waitFor(t, id, func(r RunRecord) bool {
+		return len(r.Repos) == 1 && r.Repos[0].MigrationID != ""
+	})
+	migrationID := run.Repos[0].MigrationID
+
+	if err := ts.Cancel(nil, id); err != nil {
+		t.Fatalf("error cancelling: %v", err)
+	}
+	run = ts.waitForFinish(t, id)
+
+	if run.Status != RunCancelled {
+		t.Errorf("got status %s, want cancelled", run.Status)
+	}
+	if aborted := ts.github.abortedMigrations(); !slices.Equal(aborted, []string{migrationID}) {
+		t.Errorf("got aborted migrations %v, want %s", aborted, migrationID)
+	}
+	if _, err := ts.store.Credentials(id); !errors.Is(err, ErrCredentialsNotFound) {
+		t.Errorf("credentials should be deleted once cancelled, got %v", err)
+	}
+}
+
+func TestCancelTrackedMigration(t *testing.T) {
+	ts := newTestService(t, 1, 5)
+	ts.executor.Default = MigrationQueued()
+
+	id := ts.run(t, Migration{SourceRepos: []string{"alpha"}, Options: MigrationOptions{QueueOnly: true}})
+	run := ts.waitFor(t, id, func(r RunRecord) bool {
+		_, active := activeJobs.Load(r.ID)
+		return !active && containsLine(r.Output, "following them through the migration API")
+	})
+	migrationID := repoStatus(t, run, "alpha").MigrationID
+
+	if err := ts.Cancel(nil, id); err != nil {
+		t.Fatalf("error cancelling: %v", err)
+	}
+	run, err := ts.store.Run(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if run.Status != RunCancelled {
+		t.Errorf("got status %s, want cancelled", run.Status)
+	}
+	if aborted := ts.github.abortedMigrations(); !slices.Equal(aborted, []string{migrationID}) {
+		t.Errorf("got aborted migrations %v, want %s", aborted, migrationID)
+	}
+	if _, err := ts.store.Credentials(id); !errors.Is(err, ErrCredentialsNotFound) {
+		t.Errorf("credentials should be deleted once cancelled, got %v", err)
+	}
+	if err := ts.Cancel(nil, id); !errors.Is(err, ErrRunNotActive) {
+		t.Errorf("got %v, want ErrRunNotActive", err)
+	}
+}
+
+func TestCancelQueuedMigration(t *testing.T) {
+	ts := newTestService(t, 1, 5)
+	ts.executor.Default = MigrationSucceeds(1000, 10*time.Millisecond)
+
+	running := ts.run(t, Migration{SourceRepos: []string{"alpha"}})
+	ts.waitFor(t, running, func(r RunRecord) bool { return r.Status == RunRunning })
+	queued := ts.run(t, Migration{SourceRepos: []string{"beta"}})
+
+	if position := ts.QueuePosition(queued); position != 1 {
+		t.Errorf("got queue position %d, want 1", position)
+	}
+	if err := ts.Cancel(nil, queued); err != nil {
+		t.Fatalf("error cancelling: %v", err)
+	}
+	if run := ts.waitForFinish(t, queued); run.Status != RunCancelled {
+		t.Errorf("got status %s, want cancelled", run.Status)
+	}
+	if err := ts.Cancel(nil, running); err != nil {
+		t.Fatalf("error cancelling: %v", err)
+	}
+	ts.waitForFinish(t, running)
+	for _, cmd := range ts.executor.Commands() {
+		if commandArgs(cmd)["--source-repo"] == "beta" {
+			t.Error("cancelled queued run shouldn't have started")
+		}
+	}
+}
+
+func TestCancelNeedsTargetOrgPermission(t *testing.T) {
+	ts := newTestService(t, 1, 5)
+	ts.executor.Default = MigrationSucceeds(1000, 10*time.Millisecond)
+
+	id := ts.run(t, Migration{SourceRepos: []string{"alpha"}})
+	ts.github.permissionsErr = map[string]error{"target-org": fmt.Errorf("%w: not an owner", ErrOrgRole)}
+	if err := ts.Cancel(nil, id); !errors.Is(err, ErrOrgRole) {
+		t.Errorf("got %v, want ErrOrgRole", err)
+	}
+	if run, err := ts.store.Run(id); err != nil || run.Finished() {
+		t.Errorf("got run %+v (%v), want it still going", run, err)
+	}
+
+	ts.github.permissionsErr = nil
+	if err := ts.Cancel(nil, id); err != nil {
+		t.Fatalf("error cancelling: %v", err)
+	}
+	ts.waitForFinish(t, id)
+}
+
+func TestCancelFinishedRun(t *testing.T) {
+	ts := newTestService(t, 1, 5)
+
+	id := ts.run(t, Migration{SourceRepos: []string{"alpha"}})
+	ts.waitForFinish(t, id)
+
+	if err := ts.Cancel(nil, id); !errors.Is(err, ErrRunNotActive) {
+		t.Errorf("got %v, want ErrRunNotActive", err)
+	}
+}
+
+func TestDryRunRecordsPlan(t *testing.T) {
+	ts := newTestService(t, 1, 5)
+	ts.github.orgRepos["source-org"] = []string{"alpha", "beta"}
+
+	id := ts.run(t, Migration{SourceRepos: []string{"alpha", "missing"}, DryRun: true})
+	run := ts.waitForFinish(t, id)
+
+	if run.Status != RunSucceeded {
+		t.Errorf("got status %s, want succeeded", run.Status)
+	}
+	if len(ts.executor.Commands()) != 0 {
+		t.Error("a dry run shouldn't run any commands")
+	}
+	if run.Plan == nil {
+		t.Fatal("plan wasn't recorded")
+	}
+	if !slices.Equal(run.Plan.Repos, []string{"alpha", "missing"}) || !slices.Equal(run.Plan.Missing, []string{"missing"}) {
+		t.Errorf("got plan repos %v missing %v", run.Plan.Repos, run.Plan.Missing)
+	}
+	if len(run.Plan.Steps) != 2 || !strings.HasPrefix(run.Plan.Steps[0].Command, "gh gei migrate-repo --source-repo alpha") {
+		t.Errorf("got steps %+v", run.Plan.Steps)
+	}
+}
+
+func TestRetryMigratesFailedRepos(t *testing.T) {
+	ts := newTestService(t, 1, 5)
+	ts.executor.Scripts["beta"] = MigrationFails(0, time.Millisecond, "boom")
+
+	id := ts.run(t, Migration{SourceRepos: []string{"alpha", "beta"}})
+	if _, err := ts.Retry(nil, id); !errors.Is(err, ErrRunNotFinished) {
+		t.Errorf("got %v, want ErrRunNotFinished", err)
+	}
+	ts.waitForFinish(t, id)
+	delete(ts.executor.Scripts, "beta")
+	ts.github.targetRepos = []string{"beta"} // left behind by the failed attempt
+
+	retryID, err := ts.Retry(nil, id)
+	if err != nil {
+		t.Fatalf("error retrying: %v", err)
+	}
+	retry := ts.waitForFinish(t, retryID)
+
+	if retry.RetryOf != id || !slices.Equal(retry.SourceRepos, []string{"beta"}) {
+		t.Errorf("got retry of %s for %v", retry.RetryOf, retry.SourceRepos)
+	}
+	if retry.Status != RunSucceeded {
+		t.Errorf("got status %s, want succeeded", retry.Status)
+	}
+	if !containsLine(retry.Output, "[beta] warning: target-org/beta already exists, probably from the failed attempt") {
+		t.Errorf("got output %v, want the existing target repo warned about", retry.Output)
+	}
+	if _, err := ts.Retry(nil, retryID); !errors.Is(err, ErrNothingToRetry) {
+		t.Errorf("got %v, want ErrNothingToRetry", err)
+	}
+}
+
+func TestTrackerSkipsRunsFinishedSinceListed(t *testing.T) {
+	ts := newTestService(t, 1, 5)
+
+	id := ts.run(t, Migration{SourceRepos: []string{"alpha"}})
+	run := ts.waitFor(t, id, func(r RunRecord) bool {
+		_, active := activeJobs.Load(r.ID)
+		return r.Finished() && !active
+	})
+	// as the tracker listed it, just before its job finished it
+	listed := run
+	listed.Status = RunRunning
+
+	ts.track(listed)
+	after, err := ts.store.Run(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if after.Status != run.Status || after.ExitCode != run.ExitCode || !after.FinishedAt.Equal(run.FinishedAt) {
+		t.Errorf("got status %s exit code %d, want the job's %s %d left alone", after.Status, after.ExitCode, run.Status, run.ExitCode)
+	}
+	if containsLine(after.Output, "run was interrupted") {
+		t.Errorf("finished run was reconciled, got %v", after.Output)
+	}
+}
+
+func TestReconcileGivesUpOnUnreportedMigrations(t *testing.T) {
+	ts := newTestService(t, 1, 5)
+	ts.github.migrations = []RepositoryMigration{{ID: "RM_alpha", RepositoryName: "alpha", State: "SUCCEEDED"}}
+	id := "orphaned"
+	// keeps the tracker's own pass from counting misses too, the test polls in its place
+	activeJobs.Store(id, &job{})
+	defer activeJobs.Delete(id)
+	err := ts.store.CreateRun(RunRecord{
+		ID:        id,
+		SourceOrg: "source-org",
+		TargetOrg: "target-org",
+		Repos: []RepoStatus{
+			{Repo: "alpha", State: RepoInProgress, MigrationID: "RM_alpha"},
+			{Repo: "beta", State: RepoInProgress, MigrationID: "RM_beta"},
+		},
+		QueuedAt: time.Now(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ts.store.SaveCredentials(id, Credentials{SourceToken: "source-token", TargetToken: "target-token"}); err != nil {
+		t.Fatal(err)
+	}
+
+	reconcile := func() RunRecord {
+		t.Helper()
+		run, err := ts.store.Run(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ts.reconcile(run)
+		run, err = ts.store.Run(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return run
+	}
+	for range trackerMaxMisses - 1 {
+		if run := reconcile(); run.Finished() {
+			t.Fatalf("run finished after %d polls, beta's migration should still be waited on", trackerMaxMisses-1)
+		}
+	}
+	run := reconcile()
+	if run.Status != RunFailed || run.ExitCode != 1 {
+		t.Errorf("got status %s exit code %d, want failed with 1", run.Status, run.ExitCode)
+	}
+	if status := repoStatus(t, run, "alpha"); status.State != RepoSucceeded {
+		t.Errorf("got alpha %s, want succeeded", status.State)
+	}
+	if status := repoStatus(t, run, "beta"); status.State != RepoFailed || status.Error == "" {
+		t.Errorf("got beta %+v, want failed with an error", status)
+	}
+}
@@ -0,0 +1,59 @@
+package services
+
+import (
+	"fmt"
+	"regexp"
+)
+
+// TargetNaming decides what each source repository is called in the target org. Names is checked first;
+// otherwise Pattern (if set) is replaced with Replacement and the result is wrapped in Prefix and Suffix.
+// The zero value keeps source names.
+type TargetNaming struct {
+	Prefix      string
+	Suffix      string
+	Pattern     string // regular expression, Replacement may refer to its groups as $1, ${name}, etc.
+	Replacement string
+	Names       map[string]string // explicit source name -> target name
+}
+
+func (n TargetNaming) IsZero() bool {
+	return n.Prefix == "" && n.Suffix == "" && n.Pattern == "" && len(n.Names) == 0
+}
+
+// Validate checks the pattern compiles.
+func (n TargetNaming) Validate() error {
+	if n.Pattern == "" {
+		return nil
+	}
+	if _, err := regexp.Compile(n.Pattern); err != nil {
+		return fmt.Errorf("invalid target name pattern: %w", err)
+	}
+	return nil
+}
+
+// Target returns the target name for a source repository.
+func (n TargetNaming) Target(repo string) string {
+	if name, ok := n.Names[repo]; ok && name != "" {
+		return name
+	}
+	name := repo
+	if n.Pattern != "" {
+		if pattern, err := regexp.Compile(n.Pattern); err == nil {
+			name = pattern.ReplaceAllString(name, n.Replacement)
+		}
+	}
+	return n.Prefix + name + n.Suffix
+}
+
+// Collisions returns an error naming the first pair of repos that would end up with the same target name.
+func (n TargetNaming) Collisions(repos []string) error {
+	seen := map[string]string{}
+	for _, repo := range repos {
+		target := n.Target(repo)
+		if other, ok := seen[target]; ok {
+			return fmt.Errorf("%w: %s and %s would both be migrated to %s", ErrTargetNameCollision, other, repo, target)
+		}
+		seen[target] = repo
+	}
+	return nil
+}
@@ -0,0 +1,94 @@
+package services
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+var (
+	// ErrOAuthNotConfigured is returned when signing in to a side that has no OAuth App.
+	ErrOAuthNotConfigured = errors.New("OAuth App is not configured")
+	// ErrOAuthState is returned when a sign-in callback doesn't match the sign-in started in the session.
+	ErrOAuthState = errors.New("sign-in expired or was started in another browser, try again")
+)
+
+// OAuthApp signs users in with an OAuth App's web flow, so their token is created with the scopes migrations need
+// instead of pasted in.
+type OAuthApp struct {
+	ClientID     string
+	ClientSecret string
+	URL          string // GitHub Enterprise Server or GHE.com URL the app is registered on, empty for GitHub.com
+}
+
+// OAuthState is a sign-in in progress. State is checked against the callback's, and Token is what the signed-in
+// user's token will be stored as.
+type OAuthState struct {
+	State string
+	Token Token
+}
+
+func NewOAuthState(token Token) (OAuthState, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return OAuthState{}, fmt.Errorf("failed to read random bytes: %w", err)
+	}
+	return OAuthState{State: base64.URLEncoding.EncodeToString(b), Token: token}, nil
+}
+
+// AuthorizeURL is where users are sent to sign in, asking for the scopes migrations need.
+func (a *OAuthApp) AuthorizeURL(redirectURL string, state string) string {
+	query := url.Values{
+		"client_id":    {a.ClientID},
+		"redirect_uri": {redirectURL},
+		"scope":        {strings.Join(requiredScopes, " ")},
+		"state":        {state},
+	}
+	return fmt.Sprintf("%s/login/oauth/authorize?%s", a.webURL(), query.Encode())
+}
+
+// Exchange trades the code a sign-in calls back with for the user's token.
+func (a *OAuthApp) Exchange(code string, redirectURL string) (string, error) {
+	form := url.Values{
+		"client_id":     {a.ClientID},
+		"client_secret": {a.ClientSecret},
+		"code":          {code},
+		"redirect_uri":  {redirectURL},
+	}
+	req, err := http.NewRequest(http.MethodPost, a.webURL()+"/login/oauth/access_token", strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("error completing sign-in: %w", err)
+	}
+	defer resp.Body.Close()
+	// errors such as an expired code are reported with a 200
+	var token struct {
+		AccessToken      string `json:"access_token"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&token); err != nil {
+		return "", fmt.Errorf("error completing sign-in: %s: %w", resp.Status, err)
+	}
+	if token.AccessToken == "" {
+		return "", fmt.Errorf("error completing sign-in: %s", strings.TrimSpace(token.Error+" "+token.ErrorDescription))
+	}
+	return token.AccessToken, nil
+}
+
+func (a *OAuthApp) webURL() string {
+	if a.URL == "" {
+		return "https://github.com"
+	}
+	return strings.TrimSuffix(a.URL, "/")
+}
@@ -0,0 +1,55 @@
+package services
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+func TestOAuthAppAuthorizeURL(t *testing.T) {
+	app := &OAuthApp{ClientID: "client", URL: "https://ghes.example.com/"}
+
+	u, err := url.Parse(app.AuthorizeURL("https://migrator.example.com/oauth/callback", "state"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.Host != "ghes.example.com" || u.Path != "/login/oauth/authorize" {
+		t.Errorf("got %s", u)
+	}
+	query := u.Query()
+	if query.Get("client_id") != "client" || query.Get("state") != "state" || query.Get("redirect_uri") != "https://migrator.example.com/oauth/callback" {
+		t.Errorf("got query %v", query)
+	}
+	if got := query.Get("scope"); got != "repo admin:org workflow" {
+		t.Errorf("got scope %q", got)
+	}
+}
+
+func TestOAuthAppExchange(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/login/oauth/access_token" || r.FormValue("client_secret") != "secret" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if r.FormValue("code") != "good-code" {
+			json.NewEncoder(w).Encode(map[string]string{"error": "bad_verification_code", "error_description": "The code passed is incorrect or expired."})
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]string{"access_token": "gho_token", "scope": "admin:org,repo,workflow"})
+	}))
+	t.Cleanup(server.Close)
+	app := &OAuthApp{ClientID: "client", ClientSecret: "secret", URL: server.URL}
+
+	token, err := app.Exchange("good-code", "https://migrator.example.com/oauth/callback")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token != "gho_token" {
+		t.Errorf("got token %q", token)
+	}
+	if _, err := app.Exchange("expired-code", "https://migrator.example.com/oauth/callback"); err == nil {
+		t.Error("got no error for an expired code")
+	}
+}
@@ -0,0 +1,107 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// ErrUnsupportedOption is returned when an option is set that the source's migrate-repo doesn't have, or that can't be
+// combined with the others
+var ErrUnsupportedOption = errors.New("unsupported option")
+
+// Visibilities GEI can give a migrated repository.
+var Visibilities = []string{"private", "internal", "public"}
+
+// MigrationOptions are the GEI switches a run was started with. The zero value uses GEI's defaults.
+type MigrationOptions struct {
+	TargetVisibility string // one of Visibilities, empty for GEI's default
+	SkipReleases     bool
+	LockSource       bool // make the source repo read-only while it's migrated
+	KeepArchive      bool // keep the uploaded migration archives on the target
+	QueueOnly        bool // queue migrations without waiting for them, they're followed through the migration API instead
+	// steps run for each repo once it has migrated
+	MigrateCodeScanningAlerts bool
+	MigrateSecretAlerts       bool
+}
+
+// MigrationStep is a GEI command run for a repo once its migration has succeeded, e.g. to carry its alerts over.
+type MigrationStep struct {
+	Name    string // e.g. "code scanning alerts"
+	Command string // the `gh gei` subcommand
+}
+
+var (
+	CodeScanningAlertsStep = MigrationStep{Name: "code scanning alerts", Command: "migrate-code-scanning-alerts"}
+	SecretAlertsStep       = MigrationStep{Name: "secret scanning alerts", Command: "migrate-secret-alerts"}
+)
+
+// Steps are the migration steps the options enable, in the order they run.
+func (o MigrationOptions) Steps() []MigrationStep {
+	var steps []MigrationStep
+	if o.MigrateCodeScanningAlerts {
+		steps = append(steps, CodeScanningAlertsStep)
+	}
+	if o.MigrateSecretAlerts {
+		steps = append(steps, SecretAlertsStep)
+	}
+	return steps
+}
+
+// Validate checks the visibility is one GEI supports, and that steps aren't combined with queuing, which doesn't wait
+// for repos to migrate.
+func (o MigrationOptions) Validate() error {
+	if o.TargetVisibility != "" && !slices.Contains(Visibilities, o.TargetVisibility) {
+		return fmt.Errorf("invalid target repository visibility: %s", o.TargetVisibility)
+	}
+	if o.QueueOnly && len(o.Steps()) != 0 {
+		return fmt.Errorf("%w: alerts can only be migrated once their repo has, which queue only doesn't wait for", ErrUnsupportedOption)
+	}
+	return nil
+}
+
+// Supported checks the options are ones the migrate-repo of the kind of source has: ado2gh can only set the
+// visibility and queue, and bbs2gh can't skip releases or lock the source either. Only GEI migrates alerts.
+func (o MigrationOptions) Supported(source SourceKind) error {
+	var unsupported []string
+	if source == AzureDevOpsSource || source == BitbucketServerSource {
+		if o.SkipReleases {
+			unsupported = append(unsupported, "skip releases")
+		}
+		if o.LockSource {
+			unsupported = append(unsupported, "lock source")
+		}
+		for _, step := range o.Steps() {
+			unsupported = append(unsupported, step.Name)
+		}
+	}
+	if source == AzureDevOpsSource && o.KeepArchive {
+		unsupported = append(unsupported, "keep archive")
+	}
+	if len(unsupported) != 0 {
+		return fmt.Errorf("%w for %s sources: %s", ErrUnsupportedOption, source, strings.Join(unsupported, ", "))
+	}
+	return nil
+}
+
+// args are the migrate-repo flags for the options.
+func (o MigrationOptions) args() []string {
+	var args []string
+	if o.TargetVisibility != "" {
+		args = append(args, "--target-repo-visibility", o.TargetVisibility)
+	}
+	if o.SkipReleases {
+		args = append(args, "--skip-releases")
+	}
+	if o.LockSource {
+		args = append(args, "--lock-source-repo")
+	}
+	if o.KeepArchive {
+		args = append(args, "--keep-archive")
+	}
+	if o.QueueOnly {
+		args = append(args, "--queue-only")
+	}
+	return args
+}
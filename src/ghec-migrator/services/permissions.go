@@ -0,0 +1,177 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	githubClient "github.com/google/go-github/v74/github"
+	"github.com/labstack/echo/v4"
+)
+
+var (
+	// ErrMissingPermission is returned when a fine-grained PAT lacks a permission a migration needs on an org.
+	ErrMissingPermission = errors.New("missing permission")
+	// ErrOrgRole is returned when a token's user is neither an owner of an org nor holds its migrator role.
+	ErrOrgRole = errors.New("insufficient org role")
+)
+
+// fineGrainedTokenPrefix starts fine-grained PATs, which have permissions per resource owner instead of scopes.
+const fineGrainedTokenPrefix = "github_pat_"
+
+func isFineGrained(token string) bool {
+	return strings.HasPrefix(token, fineGrainedTokenPrefix)
+}
+
+// permissionProbe is a read a fine-grained PAT can only make with permission, named as on GitHub's token settings page.
+// Probes only read, so write access (e.g. Workflows) is left for the migration itself to prove.
+type permissionProbe struct {
+	permission string
+	path       func(org string, repo string) string // repo is the first the token can see in the org, empty for org probes
+}
+
+var (
+	orgAdministrationProbe = permissionProbe{
+		permission: "Administration (organization)",
+		path: func(org string, _ string) string {
+			return fmt.Sprintf("orgs/%s/migrations?per_page=1", url.PathEscape(org))
+		},
+	}
+	repoContentsProbe = permissionProbe{
+		permission: "Contents (repository)",
+		path: func(org string, repo string) string {
+			return fmt.Sprintf("repos/%s/%s/commits?per_page=1", url.PathEscape(org), url.PathEscape(repo))
+		},
+	}
+
+	// the source's repos are exported, and the target org has migrations created in it
+	sourcePermissionProbes = []permissionProbe{orgAdministrationProbe, repoContentsProbe}
+	targetPermissionProbes = []permissionProbe{orgAdministrationProbe}
+)
+
+// OrgPermissions checks the session's token can migrate into (or out of) org: its user has to be an owner of the org or
+// hold its migrator role, and a fine-grained PAT needs the permissions probed for. Classic PATs are vouched for by their
+// scopes, and GitHub Apps by their installations. An installation can do anything in the org, including changing its
+// migrator role, so the user who signed in to use the app has to own the org (unless the app's admin secret was used).
+func (gs *GitHubAPIService) OrgPermissions(c echo.Context, t ClientType, org string) error {
+	token, err := gs.tokenService.Token(c, t)
+	if err != nil {
+		return err
+	}
+	if token.App {
+		if token.Admin {
+			return nil
+		}
+		if token.Identity == "" {
+			return fmt.Errorf("%w: %w", ErrOrgRole, ErrAppUnauthenticated)
+		}
+		apiURL := ""
+		if t == Target {
+			apiURL = gs.target.APIURL()
+		}
+		client, err := gs.tokenClient(token.Identity, apiURL)
+		if err != nil {
+			return fmt.Errorf("error getting client: %w", err)
+		}
+		return gs.orgRole(client, t, org, false)
+	}
+	client, err := gs.client(c, t)
+	if err != nil {
+		return fmt.Errorf("error getting client: %w", err)
+	}
+	if isFineGrained(token.PersonalAccess) {
+		probes := sourcePermissionProbes
+		if t == Target {
+			probes = targetPermissionProbes
+		}
+		if err := probePermissions(client, org, probes); err != nil {
+			return err
+		}
+	}
+	return gs.orgRole(client, t, org, true)
+}
+
+// SourceOrgPermissions is OrgPermissions for a source token. A GitHub Enterprise Server source takes an owner to export
+// repos, the migrator role only counts on GitHub.com.
+func (gs *GitHubAPIService) SourceOrgPermissions(sourceURL string, sourceToken string, org string) error {
+	client, err := gs.tokenClient(sourceToken, sourceURL)
+	if err != nil {
+		return fmt.Errorf("error getting client: %w", err)
+	}
+	return gs.sourceOrgPermissions(client, sourceToken, org, sourceURL == "")
+}
+
+func (gs *GitHubAPIService) sourceOrgPermissions(client *githubClient.Client, sourceToken string, org string, migratorAllowed bool) error {
+	if isFineGrained(sourceToken) {
+		if err := probePermissions(client, org, sourcePermissionProbes); err != nil {
+			return err
+		}
+	}
+	return gs.orgRole(client, Source, org, migratorAllowed)
+}
+
+// orgRole checks the token's user is an owner of org or, if migrators are allowed, holds its migrator role.
+func (gs *GitHubAPIService) orgRole(client *githubClient.Client, t ClientType, org string, migratorAllowed bool) error {
+	ctx := context.Background()
+	membership, resp, err := client.Organizations.GetOrgMembership(ctx, "", org)
+	switch {
+	case err == nil && membership.GetState() == "active" && membership.GetRole() == "admin":
+		return nil
+	case err != nil && (resp == nil || (resp.StatusCode != http.StatusForbidden && resp.StatusCode != http.StatusNotFound)):
+		return fmt.Errorf("error checking membership of %s: %w", org, err)
+	}
+	if !migratorAllowed {
+		return fmt.Errorf("%w: the %s token's user has to be an owner of %s", ErrOrgRole, t, org)
+	}
+	// only owners and migrators can see an org's repository migrations
+	query := `query($org: String!) { organization(login: $org) { repositoryMigrations(first: 1) { totalCount } } }`
+	var data struct{}
+	err = gs.graphQL(ctx, client, query, map[string]any{"org": org}, &data)
+	switch {
+	case forbidden(err):
+		return fmt.Errorf("%w: the %s token's user has to be an owner of %s or hold its migrator role", ErrOrgRole, t, org)
+	case err != nil:
+		// e.g. the API being down, rate limiting or SAML SSO enforcement, which aren't about the user's role
+		return fmt.Errorf("error checking migrator role on %s: %w", org, err)
+	}
+	return nil
+}
+
+// probePermissions makes each probe's request, a 403 or 404 meaning the token lacks its permission.
+func probePermissions(client *githubClient.Client, org string, probes []permissionProbe) error {
+	ctx := context.Background()
+	// a fine-grained PAT only sees the repos it was granted, so repo probes use one of those
+	repos, _, err := client.Repositories.ListByOrg(ctx, org, &githubClient.RepositoryListByOrgOptions{
+		ListOptions: githubClient.ListOptions{PerPage: 1},
+	})
+	if err != nil {
+		return fmt.Errorf("error listing repos: %w", err)
+	}
+	var repo string
+	if len(repos) != 0 {
+		repo = repos[0].GetName()
+	}
+	for _, probe := range probes {
+		path := probe.path(org, repo)
+		if strings.HasPrefix(path, "repos/") && repo == "" {
+			return fmt.Errorf("%w: the token can't access any repos in %s", ErrMissingPermission, org)
+		}
+		req, err := client.NewRequest(http.MethodGet, path, nil)
+		if err != nil {
+			return err
+		}
+		resp, err := client.Do(ctx, req, nil)
+		switch {
+		case resp != nil && (resp.StatusCode == http.StatusForbidden || resp.StatusCode == http.StatusNotFound):
+			return fmt.Errorf("%w: %s on %s", ErrMissingPermission, probe.permission, org)
+		case resp != nil && resp.StatusCode == http.StatusConflict:
+			// an empty repo has no commits to list, but the token could read them
+		case err != nil:
+			return fmt.Errorf("error checking %s permission: %w", probe.permission, err)
+		}
+	}
+	return nil
+}
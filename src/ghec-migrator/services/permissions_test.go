@@ -0,0 +1,131 @@
+package services
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// permissionsFixture is what a token can do in org acme.
+type permissionsFixture struct {
+	repos      []string
+	emptyRepos bool
+	denied     []string // path prefixes the token gets a 403 for
+	role       string   // membership role, empty if not a member
+	migrator   bool
+	apiStatus  int // GraphQL API failure, if any
+}
+
+func permissionsAPI(t *testing.T, f permissionsFixture) string {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path := strings.TrimPrefix(r.URL.Path, "/api/v3")
+		for _, prefix := range f.denied {
+			if strings.HasPrefix(path, prefix) {
+				w.WriteHeader(http.StatusForbidden)
+				w.Write([]byte(`{"message": "Resource not accessible by personal access token"}`))
+				return
+			}
+		}
+		switch {
+		case path == "/orgs/acme/repos":
+			var names []string
+			for _, repo := range f.repos {
+				names = append(names, `{"name": "`+repo+`"}`)
+			}
+			w.Write([]byte("[" + strings.Join(names, ",") + "]"))
+		case path == "/orgs/acme/migrations":
+			w.Write([]byte("[]"))
+		case strings.HasSuffix(path, "/commits") && f.emptyRepos:
+			w.WriteHeader(http.StatusConflict)
+			w.Write([]byte(`{"message": "Git Repository is empty."}`))
+		case strings.HasSuffix(path, "/commits"):
+			w.Write([]byte("[]"))
+		case path == "/user/memberships/orgs/acme" && f.role != "":
+			w.Write([]byte(`{"state": "active", "role": "` + f.role + `"}`))
+		case path == "/graphql" && f.apiStatus != 0:
+			w.WriteHeader(f.apiStatus)
+			w.Write([]byte(`{"message": "Server Error"}`))
+		case path == "/graphql" && f.migrator:
+			w.Write([]byte(`{"data": {"organization": {"repositoryMigrations": {"totalCount": 0}}}}`))
+		case path == "/graphql":
+			w.Write([]byte(`{"data": {"organization": null}, "errors": [{"type": "FORBIDDEN", "message": "acme does not have permission to view migrations"}]}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server.URL
+}
+
+func TestSourceOrgPermissions(t *testing.T) {
+	gs := NewGitHubService(nil, GitHubTarget{})
+	tests := []struct {
+		name    string
+		token   string
+		fixture permissionsFixture
+		ghes    bool
+		want    error
+		missing string // in the error
+	}{
+		{name: "owner", token: "ghp_x", fixture: permissionsFixture{role: "admin"}},
+		{name: "migrator", token: "ghp_x", fixture: permissionsFixture{role: "member", migrator: true}},
+		{name: "member", token: "ghp_x", fixture: permissionsFixture{role: "member"}, want: ErrOrgRole, missing: "owner of acme or hold its migrator role"},
+		{name: "outsider", token: "ghp_x", want: ErrOrgRole, missing: "owner of acme"},
+		{name: "API down", token: "ghp_x", fixture: permissionsFixture{role: "member", apiStatus: http.StatusBadGateway}, missing: "502"},
+		{name: "GHES migrator", token: "ghp_x", fixture: permissionsFixture{role: "member", migrator: true}, ghes: true, want: ErrOrgRole, missing: "has to be an owner of acme"},
+		{name: "fine-grained granted", token: "github_pat_x", fixture: permissionsFixture{repos: []string{"api"}, role: "admin"}},
+		{name: "fine-grained empty repo", token: "github_pat_x", fixture: permissionsFixture{repos: []string{"api"}, emptyRepos: true, role: "admin"}},
+		{name: "fine-grained no administration", token: "github_pat_x", fixture: permissionsFixture{repos: []string{"api"}, denied: []string{"/orgs/acme/migrations"}, role: "admin"}, want: ErrMissingPermission, missing: "Administration (organization) on acme"},
+		{name: "fine-grained no contents", token: "github_pat_x", fixture: permissionsFixture{repos: []string{"api"}, denied: []string{"/repos/acme/api/commits"}, role: "admin"}, want: ErrMissingPermission, missing: "Contents (repository) on acme"},
+		{name: "fine-grained no repos", token: "github_pat_x", fixture: permissionsFixture{role: "admin"}, want: ErrMissingPermission, missing: "can't access any repos in acme"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, err := gs.tokenClient(tt.token, permissionsAPI(t, tt.fixture))
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = gs.sourceOrgPermissions(client, tt.token, "acme", !tt.ghes)
+			switch {
+			case tt.missing == "":
+				if err != nil {
+					t.Errorf("got %v", err)
+				}
+			case tt.want == nil:
+				// failing to check isn't the same as lacking the role
+				if err == nil || errors.Is(err, ErrOrgRole) || !strings.Contains(err.Error(), tt.missing) {
+					t.Errorf("got %v, want an error other than ErrOrgRole mentioning %q", err, tt.missing)
+				}
+			case !errors.Is(err, tt.want) || !strings.Contains(err.Error(), tt.missing):
+				t.Errorf("got %v, want %v mentioning %q", err, tt.want, tt.missing)
+			}
+		})
+	}
+}
+
+func TestGitHubAppOrgPermissions(t *testing.T) {
+	gs := NewGitHubService(nil, GitHubTarget{})
+	tests := []struct {
+		name    string
+		token   Token
+		fixture permissionsFixture
+		want    error
+	}{
+		{name: "nobody signed in", token: Token{App: true}, want: ErrAppUnauthenticated},
+		{name: "admin secret", token: Token{App: true, Admin: true}},
+		{name: "signed in owner", token: Token{App: true, Identity: "gho_x"}, fixture: permissionsFixture{role: "admin"}},
+		{name: "signed in member", token: Token{App: true, Identity: "gho_x"}, fixture: permissionsFixture{role: "member"}, want: ErrOrgRole},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			source := NewGitHubSource(gs, GitHubInstance{URL: permissionsAPI(t, tt.fixture)})
+			err := source.OrgPermissions(tt.token, "acme")
+			if !errors.Is(err, tt.want) {
+				t.Errorf("got %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,78 @@
+package services
+
+import (
+	"fmt"
+	"slices"
+)
+
+// PlanStep is a single command a migration would run.
+type PlanStep struct {
+	Repo    string
+	Command string
+}
+
+// MigrationPlan is what a migration would do, as recorded by a dry run.
+type MigrationPlan struct {
+	Repos   []string
+	Steps   []PlanStep
+	Missing []string // selected repos that weren't found in the source org
+}
+
+// plan lists the repos a dry-run job would migrate and records the resulting plan without running anything.
+func (ms *MigratorServiceImpl) plan(j *job) {
+	runID := j.migration.OutputStreamName
+	plan, err := ms.buildPlan(j)
+	if j.isCancelled() {
+		ms.abort(j)
+		return
+	}
+	if err != nil {
+		ms.emit(j, err.Error())
+		ms.finishRun(runID, -1)
+		return
+	}
+	if err := ms.runStore.SavePlan(runID, plan); err != nil {
+		ms.emit(j, fmt.Sprintf("error recording plan: %v", err))
+		ms.finishRun(runID, -1)
+		return
+	}
+	ms.emit(j, fmt.Sprintf("dry run complete: %d repositories, %d commands", len(plan.Repos), len(plan.Steps)))
+	for _, repo := range plan.Missing {
+		ms.emit(j, fmt.Sprintf("warning: %s was not found in %s", repo, j.migration.SourceOrg))
+	}
+	ms.finishRun(runID, 0)
+}
+
+func (ms *MigratorServiceImpl) buildPlan(j *job) (MigrationPlan, error) {
+	orgRepos, err := j.source.Repos(j.credentials.sourceToken(), j.migration.SourceOrg)
+	if err != nil {
+		return MigrationPlan{}, fmt.Errorf("error listing repos in %s: %w", j.migration.SourceOrg, err)
+	}
+	plan := MigrationPlan{
+		Repos: j.migration.SourceRepos,
+	}
+	if len(plan.Repos) == 0 {
+		plan.Repos = orgRepos
+	}
+	if err := j.migration.TargetNaming.Collisions(plan.Repos); err != nil {
+		return MigrationPlan{}, err
+	}
+	for _, repo := range plan.Repos {
+		if !slices.Contains(orgRepos, repo) {
+			plan.Missing = append(plan.Missing, repo)
+		}
+		plan.Steps = append(plan.Steps, PlanStep{
+			Repo:    repo,
+			Command: ms.repoCommand(j, repo).String(),
+		})
+		for _, step := range j.migration.Options.Steps() {
+			cmd := j.source.StepCommand(j.migration, repo, step)
+			cmd.Args = append(cmd.Args, ms.target.args()...)
+			plan.Steps = append(plan.Steps, PlanStep{
+				Repo:    repo,
+				Command: cmd.String(),
+			})
+		}
+	}
+	return plan, nil
+}
@@ -0,0 +1,12 @@
+//go:build !unix
+
+package services
+
+import "os/exec"
+
+func setProcessGroup(cmd *exec.Cmd) {}
+
+// killProcessGroup only kills the command itself, children are left running on platforms without process groups.
+func killProcessGroup(cmd *exec.Cmd) error {
+	return cmd.Process.Kill()
+}
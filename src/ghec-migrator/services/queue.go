@@ -0,0 +1,129 @@
+package services
+
+import (
+	"errors"
+	"slices"
+	"sync"
+)
+
+// job is a migration waiting for (or being handled by) a worker. Tokens and the source provider are resolved when
+// the job is enqueued since the request that started it is long gone by the time a worker picks it up.
+type job struct {
+	migration   Migration
+	source      SourceProvider
+	credentials Credentials
+	repos       *repoTracker
+	ready       bool // its repos were already checked, by the readiness report the user was shown
+
+	mu           sync.Mutex
+	processes    []Process // currently running commands
+	migrationIDs []string  // GEI repository migrations queued on the target so far
+	cancelled    bool
+}
+
+// started records a command the job is running, killing it straight away if the job was cancelled in the meantime.
+func (j *job) started(p Process) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.processes = append(j.processes, p)
+	if j.cancelled {
+		p.Kill()
+	}
+}
+
+func (j *job) stopped(p Process) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.processes = slices.DeleteFunc(j.processes, func(running Process) bool { return running == p })
+}
+
+// cancel marks the job cancelled and kills whatever it's running.
+func (j *job) cancel() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.cancelled = true
+	var errs []error
+	for _, p := range j.processes {
+		errs = append(errs, p.Kill())
+	}
+	return errors.Join(errs...)
+}
+
+func (j *job) isCancelled() bool {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.cancelled
+}
+
+func (j *job) trackMigration(migrationID string) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if !slices.Contains(j.migrationIDs, migrationID) {
+		j.migrationIDs = append(j.migrationIDs, migrationID)
+	}
+}
+
+func (j *job) trackedMigrations() []string {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return slices.Clone(j.migrationIDs)
+}
+
+// jobQueue is a FIFO of pending jobs that workers block on.
+type jobQueue struct {
+	mu   sync.Mutex
+	cond *sync.Cond
+	jobs []*job
+}
+
+func newJobQueue() *jobQueue {
+	q := &jobQueue{}
+	q.cond = sync.NewCond(&q.mu)
+	return q
+}
+
+func (q *jobQueue) push(j *job) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.jobs = append(q.jobs, j)
+	q.cond.Signal()
+}
+
+// pop blocks until a job is available.
+func (q *jobQueue) pop() *job {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for len(q.jobs) == 0 {
+		q.cond.Wait()
+	}
+	j := q.jobs[0]
+	q.jobs = q.jobs[1:]
+	return j
+}
+
+// cancel takes a job out of the queue before a worker picks it up and has cancelled record that, both under the
+// queue's lock so a worker can't pop the job in between. It returns nil if the job isn't queued.
+func (q *jobQueue) cancel(runID string, cancelled func(j *job)) *job {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for i, j := range q.jobs {
+		if j.migration.OutputStreamName == runID {
+			q.jobs = slices.Delete(q.jobs, i, i+1)
+			cancelled(j)
+			return j
+		}
+	}
+	return nil
+}
+
+// position returns the 1-based queue position of the run, or 0 if it isn't waiting in the queue.
+func (q *jobQueue) position(runID string) int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for i, j := range q.jobs {
+		if j.migration.OutputStreamName == runID {
+			return i + 1
+		}
+	}
+	return 0
+}
@@ -0,0 +1,448 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	githubClient "github.com/google/go-github/v74/github"
+)
+
+var (
+	// ErrNotReady is returned (as a *NotReadyError) when a migration's readiness report has blocking findings.
+	ErrNotReady = errors.New("repositories aren't ready to migrate")
+	// ErrRepoNotFound is returned when a source repo doesn't exist, or the token can't see it.
+	ErrRepoNotFound = errors.New("repository not found")
+	// ErrReadinessCheckNotFound is returned for a readiness check that doesn't exist, or finished too long ago to be kept.
+	ErrReadinessCheckNotFound = errors.New("readiness check not found")
+)
+
+// GEI's limits, and the sizes past which migrations get slow or the target repo awkward to use.
+const (
+	repoSizeLimit       = 40 << 30
+	repoSizeWarning     = 10 << 30
+	objectSizeLimit     = 400 << 20
+	objectSizeWarning   = 100 << 20 // GitHub rejects pushes of files this large, so they can't be changed once migrated
+	readinessCheckLimit = 8         // repos checked at the same time
+	// readinessReportTTL is how long a report the user was shown stands in for checking again when the run starts
+	readinessReportTTL = 10 * time.Minute
+)
+
+// RepoFacts is what readiness is judged on for a source repo.
+type RepoFacts struct {
+	Size              int64 // bytes, as reported by the API
+	LargestObject     string
+	LargestObjectSize int64 // bytes
+	ObjectsTruncated  bool  // the default branch has too many files for the API to list them all
+	UsesLFS           bool  // .gitattributes routes files through Git LFS
+	Archived          bool
+	OpenPullRequests  int
+}
+
+type FindingSeverity string
+
+const (
+	FindingBlocking FindingSeverity = "blocking"
+	FindingWarning  FindingSeverity = "warning"
+)
+
+// Finding is something about a repo that will stop (blocking) or may hurt (warning) its migration.
+type Finding struct {
+	Repo     string
+	Severity FindingSeverity
+	Message  string
+}
+
+// ReadinessReport is what the pre-flight checks found in the repos of a migration.
+type ReadinessReport struct {
+	Repos    []string
+	Findings []Finding
+	// SourceChecked is false for sources whose repos can't be checked, only their target names were
+	SourceChecked bool
+}
+
+func (r ReadinessReport) Blocked() bool {
+	return slices.ContainsFunc(r.Findings, func(f Finding) bool { return f.Severity == FindingBlocking })
+}
+
+// NotReadyError carries the report of a migration that was refused for its blocking findings.
+type NotReadyError struct {
+	Report ReadinessReport
+}
+
+func (e *NotReadyError) Error() string {
+	var blocking []string
+	for _, f := range e.Report.Findings {
+		if f.Severity == FindingBlocking {
+			blocking = append(blocking, fmt.Sprintf("%s: %s", f.Repo, f.Message))
+		}
+	}
+	return fmt.Sprintf("%s: %s", ErrNotReady, strings.Join(blocking, "; "))
+}
+
+func (e *NotReadyError) Unwrap() error {
+	return ErrNotReady
+}
+
+// ReadinessCheck is how far a readiness check running in the background has got.
+type ReadinessCheck struct {
+	Repos   int // repos to check, 0 until they've been listed
+	Checked int
+	Done    bool
+	Report  ReadinessReport // once done
+	Err     error           // once done, if the check failed
+
+	startedAt time.Time
+}
+
+// Readiness starts checking the repos a migration would migrate against GEI's limits and what it leaves behind,
+// without starting it, and returns the check's ID to follow it with ReadinessCheck. A whole org takes a few API calls
+// per repo, too many for a request to wait on.
+func (ms *MigratorServiceImpl) Readiness(m Migration) (string, error) {
+	if err := m.TargetNaming.Collisions(m.SourceRepos); err != nil {
+		return "", err
+	}
+	provider, sourceToken, err := ms.sourceService.SessionProvider(m.Context)
+	if err != nil {
+		return "", err
+	}
+	targetToken, err := ms.gitHubService.Token(m.Context, Target)
+	if err != nil {
+		return "", err
+	}
+	credentials := Credentials{TargetToken: targetToken.PersonalAccess, TargetApp: targetToken.App}
+	id, err := generateStreamName()
+	if err != nil {
+		return "", err
+	}
+	m.Context = nil // the request is over by the time the check is
+	m.Source, m.SourceInstance = provider.Kind(), provider.Instance()
+	ms.startCheck(id)
+	go func() {
+		report, err := ms.readiness(m, provider, sourceToken, credentials, func(repos, checked int) {
+			ms.updateCheck(id, func(check *ReadinessCheck) {
+				check.Repos, check.Checked = repos, checked
+			})
+		})
+		if err == nil {
+			ms.cacheReport(m, report)
+		}
+		ms.updateCheck(id, func(check *ReadinessCheck) {
+			check.Done, check.Report, check.Err = true, report, err
+		})
+	}()
+	return id, nil
+}
+
+// ReadinessCheck returns how far the readiness check id has got, and its report once it's done.
+func (ms *MigratorServiceImpl) ReadinessCheck(id string) (ReadinessCheck, error) {
+	ms.checksMutex.Lock()
+	defer ms.checksMutex.Unlock()
+	check, ok := ms.checks[id]
+	if !ok {
+		return ReadinessCheck{}, ErrReadinessCheckNotFound
+	}
+	return *check, nil
+}
+
+// startCheck records a new readiness check, forgetting those that started more than readinessReportTTL ago, whose
+// reports wouldn't be reused by then anyway.
+func (ms *MigratorServiceImpl) startCheck(id string) {
+	ms.checksMutex.Lock()
+	defer ms.checksMutex.Unlock()
+	for key, check := range ms.checks {
+		if check.Done && time.Since(check.startedAt) > readinessReportTTL {
+			delete(ms.checks, key)
+		}
+	}
+	ms.checks[id] = &ReadinessCheck{startedAt: time.Now()}
+}
+
+func (ms *MigratorServiceImpl) updateCheck(id string, update func(check *ReadinessCheck)) {
+	ms.checksMutex.Lock()
+	defer ms.checksMutex.Unlock()
+	if check, ok := ms.checks[id]; ok {
+		update(check)
+	}
+}
+
+type cachedReport struct {
+	report    ReadinessReport
+	checkedAt time.Time
+}
+
+// readinessKey identifies a migration by what its readiness report depends on.
+func readinessKey(m Migration) string {
+	key, _ := json.Marshal(struct {
+		Source         SourceKind
+		SourceInstance string
+		SourceOrg      string
+		SourceRepos    []string
+		TargetOrg      string
+		TargetNaming   TargetNaming
+		RetryOf        string
+	}{m.Source, m.SourceInstance, m.SourceOrg, m.SourceRepos, m.TargetOrg, m.TargetNaming, m.RetryOf})
+	return string(key)
+}
+
+func (ms *MigratorServiceImpl) cacheReport(m Migration, report ReadinessReport) {
+	ms.reportsMutex.Lock()
+	defer ms.reportsMutex.Unlock()
+	for key, cached := range ms.reports {
+		if time.Since(cached.checkedAt) > readinessReportTTL {
+			delete(ms.reports, key)
+		}
+	}
+	ms.reports[readinessKey(m)] = cachedReport{report: report, checkedAt: time.Now()}
+}
+
+// cachedReport is the report the user was recently shown for m, if any.
+func (ms *MigratorServiceImpl) cachedReport(m Migration) (ReadinessReport, bool) {
+	ms.reportsMutex.Lock()
+	defer ms.reportsMutex.Unlock()
+	cached, ok := ms.reports[readinessKey(m)]
+	if !ok || time.Since(cached.checkedAt) > readinessReportTTL {
+		return ReadinessReport{}, false
+	}
+	return cached.report, true
+}
+
+// ready checks a job's repos before they're migrated, unless the report the user was shown already cleared them,
+// recording what was found in the run's output.
+func (ms *MigratorServiceImpl) ready(j *job, repos []string) bool {
+	if j.ready {
+		return true
+	}
+	m := j.migration
+	m.SourceRepos = repos
+	report, err := ms.readiness(m, j.source, j.credentials.sourceToken(), j.credentials, nil)
+	if err != nil {
+		ms.emit(j, fmt.Sprintf("error checking readiness: %v", err))
+		return false
+	}
+	for _, f := range report.Findings {
+		ms.emit(j, repoLine(f.Repo, fmt.Sprintf("%s: %s", f.Severity, f.Message)))
+	}
+	if report.Blocked() {
+		ms.emit(j, fmt.Sprintf("%s, fix the blocking findings or deselect their repositories", ErrNotReady))
+		return false
+	}
+	return true
+}
+
+// readiness checks m's repos, telling progress (if not nil) how many there are and how many have been checked so far.
+func (ms *MigratorServiceImpl) readiness(m Migration, provider SourceProvider, sourceToken Token, credentials Credentials, progress func(repos, checked int)) (ReadinessReport, error) {
+	repos := m.SourceRepos
+	if len(repos) == 0 {
+		var err error
+		repos, err = provider.Repos(sourceToken, m.SourceOrg)
+		if err != nil {
+			return ReadinessReport{}, fmt.Errorf("error listing repos in %s: %w", m.SourceOrg, err)
+		}
+	}
+	if progress == nil {
+		progress = func(repos, checked int) {}
+	}
+	progress(len(repos), 0)
+	targetToken, err := ms.target.token(credentials, m.TargetOrg)
+	if err != nil {
+		return ReadinessReport{}, err
+	}
+	report := ReadinessReport{Repos: repos, SourceChecked: true}
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		firstErr error
+		checked  int
+	)
+	slots := make(chan struct{}, readinessCheckLimit)
+	for _, repo := range repos {
+		wg.Add(1)
+		slots <- struct{}{}
+		go func() {
+			defer wg.Done()
+			defer func() { <-slots }()
+			findings, sourceChecked, err := ms.checkRepo(m, provider, sourceToken, targetToken, repo)
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil && firstErr == nil {
+				firstErr = fmt.Errorf("error checking %s: %w", repo, err)
+			}
+			report.Findings = append(report.Findings, findings...)
+			report.SourceChecked = report.SourceChecked && sourceChecked
+			checked++
+			progress(len(repos), checked)
+		}()
+	}
+	wg.Wait()
+	if firstErr != nil {
+		return ReadinessReport{}, firstErr
+	}
+	// blocking findings first, then in the order the repos were picked
+	slices.SortStableFunc(report.Findings, func(a, b Finding) int {
+		if a.Severity != b.Severity {
+			if a.Severity == FindingBlocking {
+				return -1
+			}
+			return 1
+		}
+		return slices.Index(repos, a.Repo) - slices.Index(repos, b.Repo)
+	})
+	return report, nil
+}
+
+// checkRepo finds what stands in the way of migrating repo, and whether its source could be checked at all.
+func (ms *MigratorServiceImpl) checkRepo(m Migration, provider SourceProvider, sourceToken Token, targetToken string, repo string) ([]Finding, bool, error) {
+	var findings []Finding
+	add := func(severity FindingSeverity, format string, a ...any) {
+		findings = append(findings, Finding{Repo: repo, Severity: severity, Message: fmt.Sprintf(format, a...)})
+	}
+
+	target := m.TargetNaming.Target(repo)
+	exists, err := ms.gitHubService.RepoExists(targetToken, m.TargetOrg, target)
+	if err != nil {
+		return nil, false, err
+	}
+	switch {
+	case exists && m.RetryOf != "":
+		// most likely left half-migrated by the failed attempt, which is no reason to refuse retrying it
+		add(FindingWarning, "%s/%s already exists, probably from the failed attempt, delete it if it's incomplete since GEI won't migrate over it", m.TargetOrg, target)
+	case exists:
+		add(FindingBlocking, "%s/%s already exists, GEI won't migrate over it", m.TargetOrg, target)
+	}
+
+	facts, err := provider.RepoFacts(sourceToken, m.SourceOrg, repo)
+	if errors.Is(err, ErrRepoNotFound) {
+		add(FindingBlocking, "not found in %s", m.SourceOrg)
+		return findings, true, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	if facts == nil {
+		return findings, false, nil
+	}
+	switch {
+	case facts.Size > repoSizeLimit:
+		add(FindingBlocking, "%s, over GEI's %s repository limit", formatBytes(facts.Size), formatBytes(repoSizeLimit))
+	case facts.Size > repoSizeWarning:
+		add(FindingWarning, "%s, large repositories take longer to migrate and are more likely to time out", formatBytes(facts.Size))
+	}
+	switch {
+	case facts.LargestObjectSize > objectSizeLimit:
+		add(FindingBlocking, "%s is %s, over GEI's %s file limit", facts.LargestObject, formatBytes(facts.LargestObjectSize), formatBytes(objectSizeLimit))
+	case facts.LargestObjectSize > objectSizeWarning:
+		add(FindingWarning, "%s is %s, it will migrate but GitHub rejects pushes of files over %s", facts.LargestObject, formatBytes(facts.LargestObjectSize), formatBytes(objectSizeWarning))
+	}
+	if facts.ObjectsTruncated {
+		add(FindingWarning, "has too many files on its default branch for all of them to be size checked")
+	}
+	if facts.UsesLFS {
+		add(FindingWarning, "uses Git LFS, whose objects GEI doesn't migrate, they have to be pushed to the target separately")
+	}
+	if facts.Archived {
+		add(FindingWarning, "is archived, check it still needs migrating")
+	}
+	if facts.OpenPullRequests != 0 {
+		add(FindingWarning, "has %d open pull requests, changes pushed to them once the migration starts won't be migrated", facts.OpenPullRequests)
+	}
+	return findings, true, nil
+}
+
+// formatBytes formats a size in binary units, e.g. "1.5 GiB".
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit && exp < 3; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGT"[exp])
+}
+
+// SourceRepo looks up what the readiness checks need to know about a source repo. Only the default branch's files
+// are size checked, which is as far as the API lists them.
+func (gs *GitHubAPIService) SourceRepo(sourceURL string, sourceToken string, org string, repo string) (RepoFacts, error) {
+	ctx := context.Background()
+	client, err := gs.tokenClient(sourceToken, sourceURL)
+	if err != nil {
+		return RepoFacts{}, fmt.Errorf("error getting client: %w", err)
+	}
+	r, resp, err := client.Repositories.Get(ctx, org, repo)
+	if resp != nil && resp.StatusCode == http.StatusNotFound {
+		return RepoFacts{}, ErrRepoNotFound
+	}
+	if err != nil {
+		return RepoFacts{}, fmt.Errorf("error getting repo: %w", err)
+	}
+	facts := RepoFacts{
+		Size:     int64(r.GetSize()) << 10, // the API reports kilobytes
+		Archived: r.GetArchived(),
+	}
+
+	pulls, resp, err := client.PullRequests.List(ctx, org, repo, &githubClient.PullRequestListOptions{
+		State:       "open",
+		ListOptions: githubClient.ListOptions{PerPage: 1},
+	})
+	if err != nil {
+		return RepoFacts{}, fmt.Errorf("error listing pull requests: %w", err)
+	}
+	// with one per page, the last page is the count
+	facts.OpenPullRequests = max(resp.LastPage, len(pulls))
+
+	attributes, _, resp, err := client.Repositories.GetContents(ctx, org, repo, ".gitattributes", nil)
+	switch {
+	case resp != nil && resp.StatusCode == http.StatusNotFound:
+		// no .gitattributes, or an empty repo
+	case err != nil:
+		return RepoFacts{}, fmt.Errorf("error getting .gitattributes: %w", err)
+	case attributes != nil:
+		content, err := attributes.GetContent()
+		if err != nil {
+			return RepoFacts{}, fmt.Errorf("error reading .gitattributes: %w", err)
+		}
+		facts.UsesLFS = strings.Contains(content, "filter=lfs")
+	}
+
+	tree, resp, err := client.Git.GetTree(ctx, org, repo, r.GetDefaultBranch(), true)
+	switch {
+	case resp != nil && (resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusConflict):
+		// an empty repo has no tree
+	case err != nil:
+		return RepoFacts{}, fmt.Errorf("error listing files: %w", err)
+	default:
+		facts.ObjectsTruncated = tree.GetTruncated()
+		for _, entry := range tree.Entries {
+			if entry.GetType() == "blob" && int64(entry.GetSize()) > facts.LargestObjectSize {
+				facts.LargestObject = entry.GetPath()
+				facts.LargestObjectSize = int64(entry.GetSize())
+			}
+		}
+	}
+	return facts, nil
+}
+
+// RepoExists checks whether a repo of that name is already in a target org.
+func (gs *GitHubAPIService) RepoExists(targetToken string, org string, repo string) (bool, error) {
+	client, err := gs.tokenClient(targetToken, gs.target.APIURL())
+	if err != nil {
+		return false, fmt.Errorf("error getting client: %w", err)
+	}
+	_, resp, err := client.Repositories.Get(context.Background(), org, repo)
+	if resp != nil && resp.StatusCode == http.StatusNotFound {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("error getting repo: %w", err)
+	}
+	return true, nil
+}
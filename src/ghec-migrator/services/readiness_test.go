@@ -0,0 +1,145 @@
+package services
+
+import (
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// readiness runs a readiness check to completion.
+func (ts *testService) readiness(t *testing.T, m Migration) ReadinessCheck {
+	t.Helper()
+	id, err := ts.Readiness(m)
+	if err != nil {
+		t.Fatalf("error starting readiness check: %v", err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		check, err := ts.ReadinessCheck(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if check.Done {
+			return check
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for readiness check, checked %d of %d", check.Checked, check.Repos)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestReadiness(t *testing.T) {
+	ts := newTestService(t, 1, 5)
+	ts.github.repoFacts = map[string]RepoFacts{
+		"huge":     {Size: 41 << 30},
+		"assets":   {Size: 2 << 30, LargestObject: "video/intro.mov", LargestObjectSize: 150 << 20, UsesLFS: true},
+		"old":      {Archived: true},
+		"busy":     {OpenPullRequests: 4},
+		"fine":     {Size: 5 << 20},
+		"toolarge": {LargestObject: "dump.sql", LargestObjectSize: 500 << 20},
+	}
+	ts.github.targetRepos = []string{"new-fine"}
+	m := Migration{
+		SourceOrg:    "source-org",
+		SourceRepos:  []string{"huge", "assets", "old", "busy", "fine", "toolarge"},
+		TargetOrg:    "target-org",
+		TargetNaming: TargetNaming{Prefix: "new-"},
+	}
+
+	check := ts.readiness(t, m)
+	if check.Err != nil {
+		t.Fatal(check.Err)
+	}
+	if check.Repos != 6 || check.Checked != 6 {
+		t.Errorf("got %d of %d repos checked, want all 6", check.Checked, check.Repos)
+	}
+	report := check.Report
+	type finding struct {
+		repo     string
+		severity FindingSeverity
+	}
+	var got []finding
+	for _, f := range report.Findings {
+		got = append(got, finding{f.Repo, f.Severity})
+	}
+	want := []finding{
+		{"huge", FindingBlocking},
+		{"fine", FindingBlocking},
+		{"toolarge", FindingBlocking},
+		{"assets", FindingWarning},
+		{"assets", FindingWarning},
+		{"old", FindingWarning},
+		{"busy", FindingWarning},
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("got findings %+v, want %+v", report.Findings, want)
+	}
+	if !report.Blocked() || !report.SourceChecked {
+		t.Errorf("got blocked %t source checked %t, want both", report.Blocked(), report.SourceChecked)
+	}
+
+	// the report just shown is reused rather than checked again while the request waits
+	var notReady *NotReadyError
+	if _, err := ts.Run(m); !errors.As(err, &notReady) || !errors.Is(err, ErrNotReady) {
+		t.Fatalf("got %v, want a NotReadyError", err)
+	}
+
+	// without one, the worker checks before migrating anything
+	run := ts.waitForFinish(t, ts.run(t, Migration{SourceRepos: []string{"fine", "old"}, TargetNaming: TargetNaming{Prefix: "new-"}}))
+	if run.Status != RunFailed || !containsLine(run.Output, "new-fine already exists") || !containsLine(run.Output, "is archived") {
+		t.Errorf("got status %s and output %v, want failed with the findings", run.Status, run.Output)
+	}
+	if len(ts.executor.Commands()) != 0 {
+		t.Error("no repos should have been migrated")
+	}
+
+	// warnings alone don't stop a run, and dry runs aren't checked
+	ts.run(t, Migration{SourceRepos: []string{"assets", "busy"}})
+	ts.run(t, Migration{SourceRepos: []string{"huge"}, DryRun: true})
+}
+
+func TestReadinessOnlyChecksTargetForOtherSources(t *testing.T) {
+	ts := newTestService(t, 1, 5)
+	ts.tokens.source = Token{PersonalAccess: "ado-pat", Type: Source, SourceKind: AzureDevOpsSource}
+	ts.github.targetRepos = []string{"web"}
+
+	check := ts.readiness(t, Migration{SourceOrg: "acme/platform", SourceRepos: []string{"web", "api"}, TargetOrg: "target-org"})
+	if check.Err != nil {
+		t.Fatal(check.Err)
+	}
+	if report := check.Report; report.SourceChecked || len(report.Findings) != 1 || report.Findings[0].Repo != "web" || !report.Blocked() {
+		t.Errorf("got report %+v, want only web's target blocking", report)
+	}
+}
+
+func TestReadinessCheckFails(t *testing.T) {
+	ts := newTestService(t, 1, 5)
+	ts.github.orgReposErr = errors.New("API down")
+
+	// a whole org is listed in the background, not while the request waits
+	check := ts.readiness(t, Migration{SourceOrg: "source-org", TargetOrg: "target-org"})
+	if check.Err == nil || !strings.Contains(check.Err.Error(), "API down") {
+		t.Errorf("got %v, want the listing's error", check.Err)
+	}
+	if _, err := ts.ReadinessCheck("missing"); !errors.Is(err, ErrReadinessCheckNotFound) {
+		t.Errorf("got %v, want ErrReadinessCheckNotFound", err)
+	}
+}
+
+func TestFormatBytes(t *testing.T) {
+	for n, want := range map[int64]string{
+		512:               "512 B",
+		1536:              "1.5 KiB",
+		400 << 20:         "400.0 MiB",
+		40 << 30:          "40.0 GiB",
+		3 << 40:           "3.0 TiB",
+		(3 << 40) + 1<<39: "3.5 TiB",
+	} {
+		if got := formatBytes(n); got != want {
+			t.Errorf("got %q for %d, want %q", got, n, want)
+		}
+	}
+}
@@ -0,0 +1,155 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+const schedulerInterval = 15 * time.Second
+
+var ErrRunNotScheduled = errors.New("run is not scheduled")
+
+// schedule records a run to be started later. Its credentials are kept (encrypted) until then, since the
+// session that scheduled it won't be around.
+func (ms *MigratorServiceImpl) schedule(record RunRecord, at time.Time, credentials Credentials) error {
+	record.Status = RunScheduled
+	record.ScheduledFor = at
+	record.QueuedAt = time.Time{}
+	if err := ms.runStore.CreateRun(record); err != nil {
+		return fmt.Errorf("error recording run: %w", err)
+	}
+	if err := ms.runStore.SaveCredentials(record.ID, credentials); err != nil {
+		ms.cancelRun(record.ID)
+		return fmt.Errorf("error saving credentials for scheduled run: %w", err)
+	}
+	return nil
+}
+
+// ScheduleEdit is what can be changed about a run before it starts.
+type ScheduleEdit struct {
+	ScheduledFor time.Time
+	SourceRepos  []string // empty to migrate every repo in the source org
+	Options      MigrationOptions
+}
+
+// Reschedule changes a scheduled run's start time, repos and options, checked as they would be when starting a run.
+// A time in the past starts it at the scheduler's next check. As with Cancel, only a session whose target token could
+// have started the run can change it.
+func (ms *MigratorServiceImpl) Reschedule(c echo.Context, runID string, edit ScheduleEdit) error {
+	run, err := ms.runStore.Run(runID)
+	if err != nil {
+		return err
+	}
+	err = ms.gitHubService.OrgPermissions(c, Target, run.TargetOrg)
+	if errors.Is(err, ErrTokenNotFound) {
+		return fmt.Errorf("%w: changing a run takes a target token that can migrate into %s", err, run.TargetOrg)
+	}
+	if err != nil {
+		return err
+	}
+	if err := edit.Options.Validate(); err != nil {
+		return err
+	}
+	if err := edit.Options.Supported(run.Source); err != nil {
+		return err
+	}
+	if err := run.TargetNaming.Collisions(edit.SourceRepos); err != nil {
+		return err
+	}
+	ms.scheduleMutex.Lock()
+	defer ms.scheduleMutex.Unlock()
+	// checked again now that it's locked, in case the scheduler launched it in the meantime
+	run, err = ms.runStore.Run(runID)
+	if err != nil {
+		return err
+	}
+	if run.Status != RunScheduled {
+		return ErrRunNotScheduled
+	}
+	// it's launched with the credentials it was scheduled with, whatever this session's are
+	credentials, err := ms.runStore.Credentials(runID)
+	if err != nil {
+		return err
+	}
+	if credentials.TargetApp {
+		if len(edit.Options.Steps()) != 0 {
+			return fmt.Errorf("%w: alerts can't be migrated with a GitHub App target token, its migrations are only queued", ErrUnsupportedOption)
+		}
+		edit.Options.QueueOnly = true
+	}
+	return ms.runStore.ScheduleRun(runID, edit)
+}
+
+// unschedule cancels a run that hasn't been launched yet.
+func (ms *MigratorServiceImpl) unschedule(runID string) error {
+	ms.scheduleMutex.Lock()
+	defer ms.scheduleMutex.Unlock()
+	run, err := ms.runStore.Run(runID)
+	if err != nil || run.Status != RunScheduled {
+		return ErrRunNotActive
+	}
+	ms.recordOutput(runID, "scheduled migration cancelled")
+	ms.cancelRun(runID)
+	return nil
+}
+
+// scheduler launches scheduled runs once their start time has passed.
+func (ms *MigratorServiceImpl) scheduler() {
+	for {
+		runs, err := ms.runStore.ActiveRuns()
+		if err != nil {
+			log.Printf("error listing scheduled runs: %v", err)
+		}
+		for _, run := range runs {
+			if run.Status == RunScheduled && !run.ScheduledFor.After(time.Now()) {
+				ms.launch(run.ID)
+			}
+		}
+		time.Sleep(schedulerInterval)
+	}
+}
+
+// launch queues a scheduled run with the credentials saved when it was scheduled.
+func (ms *MigratorServiceImpl) launch(runID string) {
+	ms.scheduleMutex.Lock()
+	defer ms.scheduleMutex.Unlock()
+	run, err := ms.runStore.Run(runID)
+	if err != nil || run.Status != RunScheduled {
+		// cancelled or rescheduled in the meantime
+		return
+	}
+	credentials, err := ms.runStore.Credentials(runID)
+	if err != nil {
+		ms.recordOutput(runID, fmt.Sprintf("unable to start scheduled migration: %v", err))
+		ms.finishRun(runID, -1)
+		return
+	}
+	provider, err := ms.sourceService.Provider(run.Source, run.SourceInstance)
+	if err != nil {
+		ms.recordOutput(runID, fmt.Sprintf("unable to start scheduled migration: %v", err))
+		ms.finishRun(runID, -1)
+		return
+	}
+	m := Migration{
+		Source:           provider.Kind(),
+		SourceInstance:   provider.Instance(),
+		SourceOrg:        run.SourceOrg,
+		SourceRepos:      run.SourceRepos,
+		TargetOrg:        run.TargetOrg,
+		TargetNaming:     run.TargetNaming,
+		Options:          run.Options,
+		DryRun:           run.DryRun,
+		RetryOf:          run.RetryOf,
+		OutputStreamName: run.ID,
+	}
+	j := newJob(m, credentials, provider)
+	activeJobs.Store(runID, j)
+	if err := ms.runStore.QueueRun(runID); err != nil {
+		log.Printf("error queuing scheduled run %s: %v", runID, err)
+	}
+	ms.enqueue(j)
+}
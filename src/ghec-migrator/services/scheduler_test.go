@@ -0,0 +1,160 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestScheduledRunLaunchesWithItsEdits(t *testing.T) {
+	ts := newTestService(t, 1, 5)
+
+	id := ts.run(t, Migration{SourceRepos: []string{"alpha", "beta"}, ScheduledFor: time.Now().Add(time.Hour)})
+	run, err := ts.store.Run(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if run.Status != RunScheduled || !run.QueuedAt.IsZero() {
+		t.Fatalf("got status %s queued at %v, want scheduled and not queued", run.Status, run.QueuedAt)
+	}
+	if _, err := ts.store.Credentials(id); err != nil {
+		t.Fatalf("credentials should be kept until it starts, got %v", err)
+	}
+
+	edit := ScheduleEdit{ScheduledFor: time.Now(), SourceRepos: []string{"gamma"}, Options: MigrationOptions{SkipReleases: true}}
+	if err := ts.Reschedule(nil, id, edit); err != nil {
+		t.Fatalf("error rescheduling: %v", err)
+	}
+	ts.launch(id)
+	run = ts.waitForFinish(t, id)
+
+	if run.Status != RunSucceeded || run.QueuedAt.IsZero() {
+		t.Errorf("got status %s queued at %v, want succeeded once queued", run.Status, run.QueuedAt)
+	}
+	commands := ts.executor.Commands()
+	if len(commands) != 1 {
+		t.Fatalf("got %d commands, want 1", len(commands))
+	}
+	if repo := commandArgs(commands[0])["--source-repo"]; repo != "gamma" || !slices.Contains(commands[0].Args, "--skip-releases") {
+		t.Errorf("got args %v, want gamma migrated without its releases", commands[0].Args)
+	}
+	if err := ts.Reschedule(nil, id, edit); !errors.Is(err, ErrRunNotScheduled) {
+		t.Errorf("got %v, want ErrRunNotScheduled once it's run", err)
+	}
+}
+
+func TestRescheduleRejectsInvalidEdits(t *testing.T) {
+	ts := newTestService(t, 1, 5)
+
+	naming := TargetNaming{Names: map[string]string{"alpha": "shared", "beta": "shared"}}
+	id := ts.run(t, Migration{SourceRepos: []string{"alpha"}, TargetNaming: naming, ScheduledFor: time.Now().Add(time.Hour)})
+	later := time.Now().Add(2 * time.Hour)
+
+	for _, test := range []struct {
+		name string
+		edit ScheduleEdit
+		want error
+	}{
+		{"colliding repos", ScheduleEdit{ScheduledFor: later, SourceRepos: []string{"alpha", "beta"}}, ErrTargetNameCollision},
+		{"conflicting options", ScheduleEdit{ScheduledFor: later, Options: MigrationOptions{QueueOnly: true, MigrateSecretAlerts: true}}, ErrUnsupportedOption},
+	} {
+		if err := ts.Reschedule(nil, id, test.edit); !errors.Is(err, test.want) {
+			t.Errorf("%s: got %v, want %v", test.name, err, test.want)
+		}
+	}
+
+	ts.github.permissionsErr = map[string]error{"target-org": fmt.Errorf("%w: not an owner", ErrOrgRole)}
+	if err := ts.Reschedule(nil, id, ScheduleEdit{ScheduledFor: later}); !errors.Is(err, ErrOrgRole) {
+		t.Errorf("got %v, want ErrOrgRole", err)
+	}
+	ts.github.permissionsErr = nil
+
+	run, err := ts.store.Run(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(run.SourceRepos, []string{"alpha"}) || run.ScheduledFor.After(later.Add(-time.Minute)) {
+		t.Errorf("got run %+v, want it unchanged", run)
+	}
+	if err := ts.Reschedule(nil, "missing", ScheduleEdit{ScheduledFor: later}); !errors.Is(err, ErrRunNotFound) {
+		t.Errorf("got %v, want ErrRunNotFound", err)
+	}
+}
+
+func TestRescheduleKeepsAppTargetQueueOnly(t *testing.T) {
+	ts := newTestService(t, 1, 5)
+	ts.tokens.target = Token{App: true, Admin: true, Type: Target}
+
+	id := ts.run(t, Migration{SourceRepos: []string{"alpha"}, ScheduledFor: time.Now().Add(time.Hour)})
+	later := time.Now().Add(2 * time.Hour)
+	if err := ts.Reschedule(nil, id, ScheduleEdit{ScheduledFor: later, Options: MigrationOptions{MigrateCodeScanningAlerts: true}}); !errors.Is(err, ErrUnsupportedOption) {
+		t.Errorf("got %v, want ErrUnsupportedOption", err)
+	}
+	if err := ts.Reschedule(nil, id, ScheduleEdit{ScheduledFor: later, Options: MigrationOptions{LockSource: true}}); err != nil {
+		t.Fatalf("error rescheduling: %v", err)
+	}
+	run, err := ts.store.Run(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (MigrationOptions{LockSource: true, QueueOnly: true}); run.Options != want {
+		t.Errorf("got options %+v, want %+v", run.Options, want)
+	}
+}
+
+func TestCancelScheduledRun(t *testing.T) {
+	ts := newTestService(t, 1, 5)
+
+	id := ts.run(t, Migration{SourceRepos: []string{"alpha"}, ScheduledFor: time.Now().Add(time.Hour)})
+	if err := ts.Cancel(nil, id); err != nil {
+		t.Fatalf("error cancelling: %v", err)
+	}
+	run := ts.waitForFinish(t, id)
+	if run.Status != RunCancelled {
+		t.Errorf("got status %s, want cancelled", run.Status)
+	}
+	if _, err := ts.store.Credentials(id); !errors.Is(err, ErrCredentialsNotFound) {
+		t.Errorf("credentials should be deleted once cancelled, got %v", err)
+	}
+	if err := ts.Reschedule(nil, id, ScheduleEdit{ScheduledFor: time.Now()}); !errors.Is(err, ErrRunNotScheduled) {
+		t.Errorf("got %v, want ErrRunNotScheduled", err)
+	}
+	ts.launch(id)
+	if len(ts.executor.Commands()) != 0 {
+		t.Error("cancelled scheduled run shouldn't have started")
+	}
+}
+
+func TestRunsListsScheduledRunsFirst(t *testing.T) {
+	// without a service, whose scheduler would launch the overdue run
+	store, err := NewRunStore(filepath.Join(t.TempDir(), "runs.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	for _, run := range []RunRecord{
+		{ID: "earlier", QueuedAt: now.Add(-time.Hour)},
+		{ID: "scheduled", Status: RunScheduled, ScheduledFor: now.Add(time.Hour)},
+		{ID: "now", QueuedAt: now},
+		{ID: "overdue", Status: RunScheduled, ScheduledFor: now.Add(-2 * time.Hour)},
+	} {
+		if err := store.CreateRun(run); err != nil {
+			t.Fatal(err)
+		}
+	}
+	runs, err := store.Runs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ids []string
+	for _, run := range runs {
+		ids = append(ids, run.ID)
+	}
+	if want := []string{"overdue", "scheduled", "now", "earlier"}; !slices.Equal(ids, want) {
+		t.Errorf("got runs %v, want %v", ids, want)
+	}
+}
@@ -0,0 +1,130 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+)
+
+// SourceKind is the kind of system repositories are migrated from.
+type SourceKind string
+
+const (
+	GitHubSource          SourceKind = "github"
+	AzureDevOpsSource     SourceKind = "ado"
+	BitbucketServerSource SourceKind = "bbs"
+)
+
+var (
+	ErrUnknownSource = errors.New("unknown source")
+	// ErrSourceMismatch is returned when a run is started for a different kind of source than the session's source token
+	ErrSourceMismatch = errors.New("source token is for a different kind of source")
+	ErrInvalidToken   = errors.New("invalid token")
+)
+
+// SourceProvider lists what can be migrated from a kind of source and builds the gh extension command that migrates
+// a repo. Repos are grouped into namespaces the way the source groups them: orgs on GitHub, `org/team-project` on
+// Azure DevOps and project keys on Bitbucket Server.
+type SourceProvider interface {
+	Kind() SourceKind
+	// Instance names the instance of its kind when several are configured, empty otherwise.
+	Instance() string
+	Label() string          // e.g. "Azure DevOps"
+	NamespaceLabel() string // what a namespace is called, e.g. "team project"
+	TokenURL() string       // where to create a token, empty if there's nowhere to link to
+	App() *GitHubApp        // the GitHub App tokens can authenticate as instead, nil if there's none
+	OAuth() *OAuthApp       // the OAuth App users can sign in with instead of pasting a token, nil if there's none
+	ValidToken(token Token) error
+	Namespaces(token Token) ([]string, error)
+	Repos(token Token, namespace string) ([]string, error)
+	OrgPermissions(token Token, namespace string) error // nil if the token can migrate the namespace's repos
+	// Command is the migrate-repo command for a repo in m.SourceOrg, without its environment.
+	Command(m Migration, repo string) Command
+	// StepCommand is the command for a migration step of a repo that has migrated, like Command. Only GitHub sources
+	// have steps.
+	StepCommand(m Migration, repo string, step MigrationStep) Command
+	// RepoFacts looks up what a repo's readiness is judged on, nil when the source can't be checked.
+	RepoFacts(token Token, namespace string, repo string) (*RepoFacts, error)
+	// Env is the environment carrying the source credentials to Command.
+	Env(credentials Credentials) []string
+}
+
+type SourceService interface {
+	Providers() []SourceProvider
+	Provider(kind SourceKind, instance string) (SourceProvider, error)
+	// SessionProvider returns the session's source token along with the provider for its kind of source.
+	SessionProvider(c echo.Context) (SourceProvider, Token, error)
+}
+
+// NewSourceService offers providers as sources, the first one being the default.
+func NewSourceService(tokenService TokenService, providers ...SourceProvider) SourceService {
+	return &SourceServiceImpl{
+		tokenService: tokenService,
+		providers:    providers,
+	}
+}
+
+type SourceServiceImpl struct {
+	tokenService TokenService
+	providers    []SourceProvider
+}
+
+func (ss *SourceServiceImpl) Providers() []SourceProvider {
+	return ss.providers
+}
+
+// Provider returns the provider for an instance of kind. Tokens and runs from before sources had kinds are GitHub's,
+// and those from before GitHub had instances are the first GitHub instance's.
+func (ss *SourceServiceImpl) Provider(kind SourceKind, instance string) (SourceProvider, error) {
+	if kind == "" {
+		kind = GitHubSource
+	}
+	for _, p := range ss.providers {
+		if p.Kind() == kind && (p.Instance() == instance || instance == "") {
+			return p, nil
+		}
+	}
+	if instance != "" {
+		return nil, fmt.Errorf("%w: %s %s", ErrUnknownSource, kind, instance)
+	}
+	return nil, fmt.Errorf("%w: %s", ErrUnknownSource, kind)
+}
+
+func (ss *SourceServiceImpl) SessionProvider(c echo.Context) (SourceProvider, Token, error) {
+	token, err := ss.tokenService.Token(c, Source)
+	if err != nil {
+		return nil, Token{}, err
+	}
+	provider, err := ss.Provider(token.SourceKind, token.SourceInstance)
+	if err != nil {
+		return nil, Token{}, err
+	}
+	return provider, token, nil
+}
+
+// getJSON decodes the JSON response to an authenticated GET, for the sources without a Go client.
+func getJSON(url string, authenticate func(*http.Request), v any) (*http.Response, error) {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	authenticate(req)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK:
+	// Azure DevOps answers a bad token with a 203 and a sign-in page
+	case http.StatusUnauthorized, http.StatusForbidden, http.StatusNonAuthoritativeInfo:
+		return resp, fmt.Errorf("%w: %s", ErrInvalidToken, resp.Status)
+	default:
+		return resp, fmt.Errorf("GET %s: %s", url, resp.Status)
+	}
+	return resp, json.NewDecoder(resp.Body).Decode(v)
+}
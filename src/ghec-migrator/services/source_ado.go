@@ -0,0 +1,211 @@
+package services
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+func NewAzureDevOpsSource() *AzureDevOpsSourceProvider {
+	return &AzureDevOpsSourceProvider{
+		apiURL:     "https://dev.azure.com",
+		profileURL: "https://app.vssps.visualstudio.com",
+	}
+}
+
+// AzureDevOpsSourceProvider migrates Azure Repos with `gh ado2gh`. Its namespaces are team projects, named
+// `org/team-project` since the same project name can exist in several organizations.
+type AzureDevOpsSourceProvider struct {
+	apiURL     string // organization-scoped REST API
+	profileURL string // profile and accounts REST API
+}
+
+const adoAPIVersion = "7.1"
+
+func (*AzureDevOpsSourceProvider) Kind() SourceKind {
+	return AzureDevOpsSource
+}
+
+func (*AzureDevOpsSourceProvider) Instance() string {
+	return ""
+}
+
+func (*AzureDevOpsSourceProvider) App() *GitHubApp {
+	return nil
+}
+
+func (*AzureDevOpsSourceProvider) OAuth() *OAuthApp {
+	return nil
+}
+
+func (*AzureDevOpsSourceProvider) Label() string {
+	return "Azure DevOps"
+}
+
+func (*AzureDevOpsSourceProvider) NamespaceLabel() string {
+	return "team project"
+}
+
+// TokenURL explains creating a PAT, which is done per organization.
+func (*AzureDevOpsSourceProvider) TokenURL() string {
+	return "https://learn.microsoft.com/en-us/azure/devops/organizations/accounts/use-personal-access-tokens-to-authenticate"
+}
+
+func (ap *AzureDevOpsSourceProvider) ValidToken(token Token) error {
+	_, err := ap.profileID(token)
+	return err
+}
+
+// Namespaces lists the team projects of every organization the token can access.
+func (ap *AzureDevOpsSourceProvider) Namespaces(token Token) ([]string, error) {
+	orgs, err := ap.orgs(token)
+	if err != nil {
+		return []string{}, err
+	}
+	var allProjects []string
+	for _, org := range orgs {
+		projects, err := ap.projects(token, org)
+		if err != nil {
+			return []string{}, err
+		}
+		for _, project := range projects {
+			allProjects = append(allProjects, org+"/"+project)
+		}
+	}
+	return allProjects, nil
+}
+
+func (ap *AzureDevOpsSourceProvider) Repos(token Token, teamProject string) ([]string, error) {
+	org, project, err := splitTeamProject(teamProject)
+	if err != nil {
+		return []string{}, err
+	}
+	var resp struct {
+		Value []struct {
+			Name string
+		}
+	}
+	_, err = getJSON(fmt.Sprintf("%s/%s/%s/_apis/git/repositories?api-version=%s", ap.apiURL, url.PathEscape(org), url.PathEscape(project), adoAPIVersion), adoAuth(token), &resp)
+	if err != nil {
+		return []string{}, fmt.Errorf("error listing repos: %w", err)
+	}
+	var allRepos []string
+	for _, repo := range resp.Value {
+		allRepos = append(allRepos, repo.Name)
+	}
+	return allRepos, nil
+}
+
+// OrgPermissions has nothing to check, the token's access shows in which team projects it lists.
+func (*AzureDevOpsSourceProvider) OrgPermissions(token Token, namespace string) error {
+	return nil
+}
+
+// Command builds the `gh ado2gh migrate-repo` for a repo.
+func (*AzureDevOpsSourceProvider) Command(m Migration, repo string) Command {
+	// the team project was validated when it was listed, a malformed one makes gh fail with a clear message
+	org, project, _ := splitTeamProject(m.SourceOrg)
+	args := []string{
+		"ado2gh",
+		"migrate-repo",
+		"--ado-org", org,
+		"--ado-team-project", project,
+		"--ado-repo", repo,
+		"--github-org", m.TargetOrg,
+		"--github-repo", m.TargetNaming.Target(repo),
+	}
+	args = append(args, m.Options.args()...)
+	return Command{Args: args}
+}
+
+// StepCommand is empty, alerts are only migrated from GitHub and the options are refused for other sources.
+func (*AzureDevOpsSourceProvider) StepCommand(m Migration, repo string, step MigrationStep) Command {
+	return Command{}
+}
+
+// RepoFacts is nil, only GitHub sources are checked before a run.
+func (*AzureDevOpsSourceProvider) RepoFacts(token Token, namespace string, repo string) (*RepoFacts, error) {
+	return nil, nil
+}
+
+func (*AzureDevOpsSourceProvider) Env(credentials Credentials) []string {
+	return []string{
+		fmt.Sprintf("ADO_PAT=%s", credentials.SourceToken),
+	}
+}
+
+func (ap *AzureDevOpsSourceProvider) profileID(token Token) (string, error) {
+	var profile struct {
+		ID string
+	}
+	_, err := getJSON(fmt.Sprintf("%s/_apis/profile/profiles/me?api-version=%s", ap.profileURL, adoAPIVersion), adoAuth(token), &profile)
+	if err != nil {
+		return "", fmt.Errorf("error getting profile: %w", err)
+	}
+	return profile.ID, nil
+}
+
+func (ap *AzureDevOpsSourceProvider) orgs(token Token) ([]string, error) {
+	memberID, err := ap.profileID(token)
+	if err != nil {
+		return []string{}, err
+	}
+	var resp struct {
+		Value []struct {
+			AccountName string
+		}
+	}
+	_, err = getJSON(fmt.Sprintf("%s/_apis/accounts?memberId=%s&api-version=%s", ap.profileURL, url.QueryEscape(memberID), adoAPIVersion), adoAuth(token), &resp)
+	if err != nil {
+		return []string{}, fmt.Errorf("error listing orgs: %w", err)
+	}
+	var allOrgs []string
+	for _, account := range resp.Value {
+		allOrgs = append(allOrgs, account.AccountName)
+	}
+	return allOrgs, nil
+}
+
+func (ap *AzureDevOpsSourceProvider) projects(token Token, org string) ([]string, error) {
+	var allProjects []string
+	continuationToken := ""
+	for {
+		var resp struct {
+			Value []struct {
+				Name string
+			}
+		}
+		projectsURL := fmt.Sprintf("%s/%s/_apis/projects?$top=100&api-version=%s", ap.apiURL, url.PathEscape(org), adoAPIVersion)
+		if continuationToken != "" {
+			projectsURL += "&continuationToken=" + url.QueryEscape(continuationToken)
+		}
+		r, err := getJSON(projectsURL, adoAuth(token), &resp)
+		if err != nil {
+			return []string{}, fmt.Errorf("error listing team projects in %s: %w", org, err)
+		}
+		for _, project := range resp.Value {
+			allProjects = append(allProjects, project.Name)
+		}
+		continuationToken = r.Header.Get("X-MS-ContinuationToken")
+		if continuationToken == "" {
+			break
+		}
+	}
+	return allProjects, nil
+}
+
+// adoAuth authenticates with a PAT, which Azure DevOps takes as the password of a blank user.
+func adoAuth(token Token) func(*http.Request) {
+	return func(req *http.Request) {
+		req.SetBasicAuth("", token.PersonalAccess)
+	}
+}
+
+func splitTeamProject(teamProject string) (string, string, error) {
+	org, project, ok := strings.Cut(teamProject, "/")
+	if !ok || org == "" || project == "" {
+		return "", "", fmt.Errorf("invalid team project %q, expected org/team-project", teamProject)
+	}
+	return org, project, nil
+}
@@ -0,0 +1,175 @@
+package services
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+)
+
+func NewBitbucketServerSource(serverURL string) *BitbucketServerSourceProvider {
+	return &BitbucketServerSourceProvider{
+		serverURL: strings.TrimSuffix(serverURL, "/"),
+	}
+}
+
+// BitbucketServerSourceProvider migrates from a Bitbucket Server (or Data Center) instance with `gh bbs2gh`, which
+// authenticates with a username and a password or HTTP access token. bbs2gh downloads each repo's export archive over
+// SSH when SSHUser and SSHPrivateKeyFile are set, and uploads it to the Azure Blob Storage account in
+// AZURE_STORAGE_CONNECTION_STRING or, with AWS_BUCKET_NAME, to S3.
+type BitbucketServerSourceProvider struct {
+	serverURL         string
+	SSHUser           string
+	SSHPrivateKeyFile string // a path, bbs2gh reads the key from it so the key never shows in a command line
+}
+
+// bbsStorageEnv are passed through to bbs2gh for uploading archives.
+var bbsStorageEnv = []string{"AZURE_STORAGE_CONNECTION_STRING", "AWS_ACCESS_KEY_ID", "AWS_SECRET_ACCESS_KEY", "AWS_REGION"}
+
+func (*BitbucketServerSourceProvider) Kind() SourceKind {
+	return BitbucketServerSource
+}
+
+func (*BitbucketServerSourceProvider) Instance() string {
+	return ""
+}
+
+func (*BitbucketServerSourceProvider) App() *GitHubApp {
+	return nil
+}
+
+func (*BitbucketServerSourceProvider) OAuth() *OAuthApp {
+	return nil
+}
+
+func (*BitbucketServerSourceProvider) Label() string {
+	return "Bitbucket Server"
+}
+
+func (*BitbucketServerSourceProvider) NamespaceLabel() string {
+	return "project"
+}
+
+// TokenURL is where HTTP access tokens are created, which can be used instead of a password.
+func (bp *BitbucketServerSourceProvider) TokenURL() string {
+	return bp.serverURL + "/plugins/servlet/access-tokens/manage"
+}
+
+func (bp *BitbucketServerSourceProvider) ValidToken(token Token) error {
+	if token.Username == "" {
+		return fmt.Errorf("%w: missing username", ErrInvalidToken)
+	}
+	var resp bbsPage[struct{}]
+	_, err := getJSON(bp.serverURL+"/rest/api/1.0/projects?limit=1", bbsAuth(token), &resp)
+	if err != nil {
+		return fmt.Errorf("error checking credentials: %w", err)
+	}
+	return nil
+}
+
+// Namespaces lists project keys, which is how bbs2gh identifies projects.
+func (bp *BitbucketServerSourceProvider) Namespaces(token Token) ([]string, error) {
+	projects, err := listBBS[struct{ Key string }](bp.serverURL+"/rest/api/1.0/projects", token)
+	if err != nil {
+		return []string{}, fmt.Errorf("error listing projects: %w", err)
+	}
+	var allProjects []string
+	for _, project := range projects {
+		allProjects = append(allProjects, project.Key)
+	}
+	return allProjects, nil
+}
+
+// Repos lists repo slugs, which is how bbs2gh identifies repos.
+func (bp *BitbucketServerSourceProvider) Repos(token Token, project string) ([]string, error) {
+	repos, err := listBBS[struct{ Slug string }](fmt.Sprintf("%s/rest/api/1.0/projects/%s/repos", bp.serverURL, url.PathEscape(project)), token)
+	if err != nil {
+		return []string{}, fmt.Errorf("error listing repos: %w", err)
+	}
+	var allRepos []string
+	for _, repo := range repos {
+		allRepos = append(allRepos, repo.Slug)
+	}
+	return allRepos, nil
+}
+
+// OrgPermissions has nothing to check, the token's access shows in which projects it lists.
+func (*BitbucketServerSourceProvider) OrgPermissions(token Token, namespace string) error {
+	return nil
+}
+
+// Command builds the `gh bbs2gh migrate-repo` for a repo.
+func (bp *BitbucketServerSourceProvider) Command(m Migration, repo string) Command {
+	args := []string{
+		"bbs2gh",
+		"migrate-repo",
+		"--bbs-server-url", bp.serverURL,
+		"--bbs-project", m.SourceOrg,
+		"--bbs-repo", repo,
+		"--github-org", m.TargetOrg,
+		"--github-repo", m.TargetNaming.Target(repo),
+	}
+	if bp.SSHUser != "" && bp.SSHPrivateKeyFile != "" {
+		args = append(args, "--ssh-user", bp.SSHUser, "--ssh-private-key", bp.SSHPrivateKeyFile)
+	}
+	if bucket := os.Getenv("AWS_BUCKET_NAME"); bucket != "" {
+		args = append(args, "--aws-bucket-name", bucket)
+	}
+	args = append(args, m.Options.args()...)
+	return Command{Args: args}
+}
+
+// StepCommand is empty, alerts are only migrated from GitHub and the options are refused for other sources.
+func (*BitbucketServerSourceProvider) StepCommand(m Migration, repo string, step MigrationStep) Command {
+	return Command{}
+}
+
+// RepoFacts is nil like Azure DevOps', only the target names of Bitbucket Server repos are checked before a run.
+func (*BitbucketServerSourceProvider) RepoFacts(token Token, namespace string, repo string) (*RepoFacts, error) {
+	return nil, nil
+}
+
+func (*BitbucketServerSourceProvider) Env(credentials Credentials) []string {
+	env := []string{
+		fmt.Sprintf("BBS_USERNAME=%s", credentials.SourceUsername),
+		fmt.Sprintf("BBS_PASSWORD=%s", credentials.SourceToken),
+	}
+	for _, name := range bbsStorageEnv {
+		if value := os.Getenv(name); value != "" {
+			env = append(env, fmt.Sprintf("%s=%s", name, value))
+		}
+	}
+	return env
+}
+
+// bbsPage is a page of a Bitbucket Server paged API response.
+type bbsPage[T any] struct {
+	Values        []T
+	IsLastPage    bool
+	NextPageStart int
+}
+
+func listBBS[T any](endpoint string, token Token) ([]T, error) {
+	var all []T
+	start := 0
+	for {
+		var page bbsPage[T]
+		_, err := getJSON(fmt.Sprintf("%s?limit=100&start=%d", endpoint, start), bbsAuth(token), &page)
+		if err != nil {
+			return nil, err
+		}
+		all = append(all, page.Values...)
+		if page.IsLastPage {
+			break
+		}
+		start = page.NextPageStart
+	}
+	return all, nil
+}
+
+func bbsAuth(token Token) func(*http.Request) {
+	return func(req *http.Request) {
+		req.SetBasicAuth(token.Username, token.PersonalAccess)
+	}
+}
@@ -0,0 +1,202 @@
+package services
+
+import (
+	"fmt"
+	"strings"
+)
+
+// GitHubInstance is a GitHub repos can be migrated from. Several GitHub Enterprise Server instances can be configured,
+// told apart by name.
+type GitHubInstance struct {
+	Name  string
+	URL   string     // GitHub Enterprise Server URL, empty for GitHub.com
+	App   *GitHubApp // optional
+	OAuth *OAuthApp  // optional
+}
+
+// ParseGitHubInstances parses a comma-separated list of `name=url` GitHub Enterprise Server instances.
+func ParseGitHubInstances(list string) ([]GitHubInstance, error) {
+	var instances []GitHubInstance
+	for entry := range strings.SplitSeq(list, ",") {
+		name, url, ok := strings.Cut(entry, "=")
+		name, url = strings.TrimSpace(name), strings.TrimSpace(url)
+		if !ok || name == "" || url == "" {
+			return nil, fmt.Errorf("invalid GitHub Enterprise Server instance %q, expected name=url", entry)
+		}
+		for _, instance := range instances {
+			if instance.Name == name {
+				return nil, fmt.Errorf("duplicate GitHub Enterprise Server instance name %q", name)
+			}
+		}
+		instances = append(instances, GitHubInstance{Name: name, URL: url})
+	}
+	return instances, nil
+}
+
+func NewGitHubSource(gitHubService GitHubService, instance GitHubInstance) *GitHubSourceProvider {
+	instance.URL = strings.TrimSuffix(instance.URL, "/")
+	return &GitHubSourceProvider{
+		gitHubService: gitHubService,
+		instance:      instance,
+	}
+}
+
+// GitHubSourceProvider migrates from an instance of GitHub with `gh gei`.
+type GitHubSourceProvider struct {
+	gitHubService GitHubService
+	instance      GitHubInstance
+}
+
+func (*GitHubSourceProvider) Kind() SourceKind {
+	return GitHubSource
+}
+
+func (gp *GitHubSourceProvider) Instance() string {
+	return gp.instance.Name
+}
+
+func (gp *GitHubSourceProvider) Label() string {
+	switch {
+	case gp.instance.Name != "":
+		return gp.instance.Name
+	case gp.instance.URL != "":
+		return "GitHub Enterprise Server"
+	}
+	return "GitHub"
+}
+
+func (gp *GitHubSourceProvider) App() *GitHubApp {
+	return gp.instance.App
+}
+
+func (gp *GitHubSourceProvider) OAuth() *OAuthApp {
+	return gp.instance.OAuth
+}
+
+func (*GitHubSourceProvider) NamespaceLabel() string {
+	return "org"
+}
+
+func (gp *GitHubSourceProvider) TokenURL() string {
+	url := gp.instance.URL
+	if url == "" {
+		url = "https://github.com"
+	}
+	return fmt.Sprintf("%s/settings/tokens/new", url)
+}
+
+func (gp *GitHubSourceProvider) ValidToken(token Token) error {
+	if token.App {
+		if gp.instance.App == nil {
+			return ErrAppNotConfigured
+		}
+		return gp.instance.App.Validate()
+	}
+	scopes, err := gp.gitHubService.SourceScopes(gp.instance.URL, token.PersonalAccess)
+	if err != nil {
+		return err
+	}
+	return requireScopes(scopes)
+}
+
+// Namespaces lists the orgs the token can see, or those the GitHub App is installed on.
+func (gp *GitHubSourceProvider) Namespaces(token Token) ([]string, error) {
+	if token.App {
+		if gp.instance.App == nil {
+			return []string{}, ErrAppNotConfigured
+		}
+		return gp.instance.App.Orgs()
+	}
+	return gp.gitHubService.SourceOrgs(gp.instance.URL, token.PersonalAccess)
+}
+
+func (gp *GitHubSourceProvider) Repos(token Token, org string) ([]string, error) {
+	orgToken, err := gp.orgToken(token, org)
+	if err != nil {
+		return []string{}, err
+	}
+	return gp.gitHubService.OrgRepos(gp.instance.URL, orgToken, org)
+}
+
+func (gp *GitHubSourceProvider) RepoFacts(token Token, org string, repo string) (*RepoFacts, error) {
+	orgToken, err := gp.orgToken(token, org)
+	if err != nil {
+		return nil, err
+	}
+	facts, err := gp.gitHubService.SourceRepo(gp.instance.URL, orgToken, org, repo)
+	if err != nil {
+		return nil, err
+	}
+	return &facts, nil
+}
+
+// orgToken is the token for org, an installation token when token authenticates as the GitHub App.
+func (gp *GitHubSourceProvider) orgToken(token Token, org string) (string, error) {
+	if !token.App {
+		return token.PersonalAccess, nil
+	}
+	if gp.instance.App == nil {
+		return "", ErrAppNotConfigured
+	}
+	return gp.instance.App.InstallationToken(org)
+}
+
+// OrgPermissions checks the token's user can migrate out of org. A GitHub App's installation is its permission, but
+// whoever signed in to use it has to be able to migrate out of org themselves.
+func (gp *GitHubSourceProvider) OrgPermissions(token Token, org string) error {
+	if token.App {
+		if token.Admin {
+			return nil
+		}
+		if token.Identity == "" {
+			return fmt.Errorf("%w: %w", ErrOrgRole, ErrAppUnauthenticated)
+		}
+		return gp.gitHubService.SourceOrgPermissions(gp.instance.URL, token.Identity, org)
+	}
+	return gp.gitHubService.SourceOrgPermissions(gp.instance.URL, token.PersonalAccess, org)
+}
+
+// Command builds the `gh gei migrate-repo` for a repo.
+func (gp *GitHubSourceProvider) Command(m Migration, repo string) Command {
+	args := []string{
+		"gei",
+		"migrate-repo",
+		"--source-repo", repo,
+	}
+	if target := m.TargetNaming.Target(repo); target != repo {
+		args = append(args, "--target-repo", target)
+	}
+	args = append(args,
+		"--github-source-org", m.SourceOrg,
+		"--github-target-org", m.TargetOrg,
+	)
+	if gp.instance.URL != "" {
+		args = append(args, "--ghes-api-url", fmt.Sprintf("%s/api/v3", gp.instance.URL))
+	}
+	args = append(args, m.Options.args()...)
+	return Command{Args: args}
+}
+
+// StepCommand is `gh gei migrate-code-scanning-alerts` or `migrate-secret-alerts`, which name their flags differently
+// from migrate-repo.
+func (gp *GitHubSourceProvider) StepCommand(m Migration, repo string, step MigrationStep) Command {
+	args := []string{
+		"gei",
+		step.Command,
+		"--source-org", m.SourceOrg,
+		"--source-repo", repo,
+		"--target-org", m.TargetOrg,
+		"--target-repo", m.TargetNaming.Target(repo),
+	}
+	if gp.instance.URL != "" {
+		args = append(args, "--ghes-api-url", fmt.Sprintf("%s/api/v3", gp.instance.URL))
+	}
+	return Command{Args: args}
+}
+
+func (*GitHubSourceProvider) Env(credentials Credentials) []string {
+	return []string{
+		fmt.Sprintf("GH_TOKEN=%s", credentials.SourceToken),
+		fmt.Sprintf("GH_SOURCE_PAT=%s", credentials.SourceToken),
+	}
+}
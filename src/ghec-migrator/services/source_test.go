@@ -0,0 +1,136 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+)
+
+// sourceAPI serves JSON responses by path to requests authenticated as username:password.
+func sourceAPI(t *testing.T, username string, password string, responses map[string]any) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if u, p, ok := r.BasicAuth(); !ok || u != username || p != password {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		key := r.URL.Path
+		if continuation := r.URL.Query().Get("continuationToken"); continuation != "" {
+			key += "?continuationToken=" + continuation
+		}
+		if start := r.URL.Query().Get("start"); start != "" && start != "0" {
+			key += "?start=" + start
+		}
+		resp, ok := responses[key]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if key == "/contoso/_apis/projects" {
+			w.Header().Set("X-MS-ContinuationToken", "next")
+		}
+		json.NewEncoder(w).Encode(resp)
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestParseGitHubInstances(t *testing.T) {
+	instances, err := ParseGitHubInstances("ghes-east=https://ghes-east.example.com, ghes-west = https://ghes-west.example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []GitHubInstance{{Name: "ghes-east", URL: "https://ghes-east.example.com"}, {Name: "ghes-west", URL: "https://ghes-west.example.com"}}
+	if !slices.Equal(instances, want) {
+		t.Errorf("got %v, want %v", instances, want)
+	}
+	for _, invalid := range []string{"https://ghes.example.com", "ghes=", "a=https://a.example.com,a=https://b.example.com"} {
+		if _, err := ParseGitHubInstances(invalid); err == nil {
+			t.Errorf("parsed invalid instances %q", invalid)
+		}
+	}
+}
+
+func TestAzureDevOpsSource(t *testing.T) {
+	server := sourceAPI(t, "", "pat", map[string]any{
+		"/_apis/profile/profiles/me":                     map[string]any{"id": "me"},
+		"/_apis/accounts":                                map[string]any{"value": []any{map[string]any{"accountName": "contoso"}}},
+		"/contoso/_apis/projects":                        map[string]any{"value": []any{map[string]any{"name": "Fabrikam"}}},
+		"/contoso/_apis/projects?continuationToken=next": map[string]any{"value": []any{map[string]any{"name": "Web Apps"}}},
+		"/contoso/Web Apps/_apis/git/repositories":       map[string]any{"value": []any{map[string]any{"name": "site"}, map[string]any{"name": "api"}}},
+	})
+	ado := NewAzureDevOpsSource()
+	ado.apiURL, ado.profileURL = server.URL, server.URL
+	token := Token{PersonalAccess: "pat"}
+
+	if err := ado.ValidToken(token); err != nil {
+		t.Errorf("valid token rejected: %v", err)
+	}
+	if err := ado.ValidToken(Token{PersonalAccess: "wrong"}); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("got %v for an invalid token, want ErrInvalidToken", err)
+	}
+	projects, err := ado.Namespaces(token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"contoso/Fabrikam", "contoso/Web Apps"}; !slices.Equal(projects, want) {
+		t.Errorf("got team projects %v, want %v", projects, want)
+	}
+	repos, err := ado.Repos(token, "contoso/Web Apps")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"site", "api"}; !slices.Equal(repos, want) {
+		t.Errorf("got repos %v, want %v", repos, want)
+	}
+	if _, err := ado.Repos(token, "Web Apps"); err == nil {
+		t.Error("listed repos of a team project without an org")
+	}
+}
+
+func TestBitbucketServerSource(t *testing.T) {
+	server := sourceAPI(t, "jdoe", "secret", map[string]any{
+		"/rest/api/1.0/projects":            map[string]any{"values": []any{map[string]any{"key": "PLAT"}}, "isLastPage": false, "nextPageStart": 1},
+		"/rest/api/1.0/projects?start=1":    map[string]any{"values": []any{map[string]any{"key": "DATA"}}, "isLastPage": true},
+		"/rest/api/1.0/projects/PLAT/repos": map[string]any{"values": []any{map[string]any{"slug": "api-gateway"}}, "isLastPage": true},
+	})
+	bbs := NewBitbucketServerSource(server.URL + "/")
+	token := Token{PersonalAccess: "secret", Username: "jdoe"}
+
+	if err := bbs.ValidToken(token); err != nil {
+		t.Errorf("valid credentials rejected: %v", err)
+	}
+	if err := bbs.ValidToken(Token{PersonalAccess: "wrong", Username: "jdoe"}); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("got %v for invalid credentials, want ErrInvalidToken", err)
+	}
+	projects, err := bbs.Namespaces(token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"PLAT", "DATA"}; !slices.Equal(projects, want) {
+		t.Errorf("got projects %v, want %v", projects, want)
+	}
+	repos, err := bbs.Repos(token, "PLAT")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"api-gateway"}; !slices.Equal(repos, want) {
+		t.Errorf("got repos %v, want %v", repos, want)
+	}
+
+	bbs.SSHUser, bbs.SSHPrivateKeyFile = "atlbitbucket", "/etc/ghec-migrator/bbs_ssh_key"
+	args := commandArgs(bbs.Command(Migration{SourceOrg: "PLAT", TargetOrg: "target-org"}, "api-gateway"))
+	if args["--ssh-private-key"] != "/etc/ghec-migrator/bbs_ssh_key" {
+		t.Errorf("got --ssh-private-key %q, want the key's path", args["--ssh-private-key"])
+	}
+}
+
+func TestCommandStringRedactsSecrets(t *testing.T) {
+	cmd := Command{Args: []string{"bbs2gh", "migrate-repo", "--bbs-password", "secret", "--bbs-repo", "api-gateway"}}
+	if got, want := cmd.String(), "gh bbs2gh migrate-repo --bbs-password *** --bbs-repo api-gateway"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,291 @@
+package services
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+type RepoState string
+
+const (
+	RepoPending    RepoState = "pending"
+	RepoQueued     RepoState = "queued"
+	RepoInProgress RepoState = "in progress"
+	RepoSucceeded  RepoState = "succeeded"
+	RepoFailed     RepoState = "failed"
+)
+
+// RepoStatus is the progress of a single repository within a run.
+type RepoStatus struct {
+	Repo        string
+	TargetRepo  string // name in the target org, when it differs from Repo
+	State       RepoState
+	MigrationID string
+	StartedAt   time.Time
+	FinishedAt  time.Time
+	ExitCode    *int // of the repo's `gh gei migrate-repo`, nil until it exits
+	Error       string
+	Steps       []StepStatus // the run's migration steps, which start once the repo has migrated
+}
+
+// StepStatus is the progress of a migration step (e.g. migrating code scanning alerts) for a repo.
+type StepStatus struct {
+	Name     string
+	State    RepoState // pending, in progress, succeeded or failed
+	ExitCode *int
+	Error    string
+}
+
+func (s RepoStatus) Done() bool {
+	return s.State == RepoSucceeded || s.State == RepoFailed
+}
+
+func (s StepStatus) Done() bool {
+	return s.State == RepoSucceeded || s.State == RepoFailed
+}
+
+// Duration is how long the repo has been (or was) migrating.
+func (s RepoStatus) Duration() time.Duration {
+	if s.StartedAt.IsZero() {
+		return 0
+	}
+	end := s.FinishedAt
+	if end.IsZero() {
+		end = time.Now()
+	}
+	return end.Sub(s.StartedAt).Round(time.Second)
+}
+
+var (
+	queuedLinePattern = regexp.MustCompile(`was successfully queued`)
+	stateLinePattern  = regexp.MustCompile(`State: ([A-Z_]+)`)
+	failedLinePattern = regexp.MustCompile(`Migration Failed`)
+	errorLinePattern  = regexp.MustCompile(`\[ERROR\] (.+)`)
+)
+
+// repoTracker builds per-repo status from the output of a run's `gh gei migrate-repo` commands, which may run concurrently.
+type repoTracker struct {
+	mu         sync.Mutex
+	naming     TargetNaming
+	queueOnly  bool
+	steps      []MigrationStep
+	repos      []RepoStatus
+	index      map[string]int
+	lastErrors map[string]string // last error logged by each repo's command, reported if it fails
+}
+
+func newRepoTracker(m Migration) *repoTracker {
+	t := &repoTracker{
+		naming:     m.TargetNaming,
+		queueOnly:  m.Options.QueueOnly,
+		steps:      m.Options.Steps(),
+		index:      map[string]int{},
+		lastErrors: map[string]string{},
+	}
+	t.add(m.SourceRepos...)
+	return t
+}
+
+// add starts tracking repos as pending.
+func (t *repoTracker) add(repos ...string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, repo := range repos {
+		t.get(repo)
+	}
+}
+
+func (t *repoTracker) statuses() []RepoStatus {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return slices.Clone(t.repos)
+}
+
+func (t *repoTracker) status(repo string) RepoStatus {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return *t.get(repo)
+}
+
+// inFlight counts repos with a migration queued on the target that hasn't finished.
+func (t *repoTracker) inFlight() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	n := 0
+	for _, s := range t.repos {
+		if s.MigrationID != "" && !s.Done() {
+			n++
+		}
+	}
+	return n
+}
+
+// get returns the tracked status of repo, tracking it first if need be. The caller must hold mu.
+func (t *repoTracker) get(repo string) *RepoStatus {
+	if _, ok := t.index[repo]; !ok {
+		s := RepoStatus{Repo: repo, State: RepoPending}
+		for _, step := range t.steps {
+			s.Steps = append(s.Steps, StepStatus{Name: step.Name, State: RepoPending})
+		}
+		if target := t.naming.Target(repo); target != repo {
+			s.TargetRepo = target
+		}
+		t.index[repo] = len(t.repos)
+		t.repos = append(t.repos, s)
+	}
+	return &t.repos[t.index[repo]]
+}
+
+// begin marks repo's migration as started.
+func (t *repoTracker) begin(repo string) RepoStatus {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.lastErrors, repo)
+	s := t.get(repo)
+	if s.StartedAt.IsZero() {
+		s.StartedAt = time.Now()
+	}
+	return *s
+}
+
+// parse updates repo's status from a line of its command's output, returning the changed status if there was one.
+func (t *repoTracker) parse(repo string, line string) (RepoStatus, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	s := t.get(repo)
+	changed := false
+
+	if migrationID := migrationIDPattern.FindString(line); migrationID != "" && s.MigrationID == "" {
+		s.MigrationID = migrationID
+		changed = true
+	}
+	var state RepoState
+	switch {
+	case failedLinePattern.MatchString(line):
+		state = RepoFailed
+	case queuedLinePattern.MatchString(line):
+		state = RepoQueued
+	case stateLinePattern.MatchString(line):
+		state = geiState(stateLinePattern.FindStringSubmatch(line)[1])
+	}
+	if state != "" && state != s.State && !s.Done() {
+		t.transition(s, state)
+		changed = true
+	}
+	if m := errorLinePattern.FindStringSubmatch(line); m != nil && state == "" {
+		// GEI reports the failure reason on its own line after the one saying the migration failed
+		if s.State == RepoFailed && s.Error == "" {
+			s.Error = m[1]
+			changed = true
+		} else {
+			t.lastErrors[repo] = m[1]
+		}
+	}
+	return *s, changed
+}
+
+// exited records the exit code of repo's command, and its outcome if the output didn't already say how it ended.
+func (t *repoTracker) exited(repo string, exitCode int) RepoStatus {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	s := t.get(repo)
+	s.ExitCode = &exitCode
+	if s.Done() {
+		return *s
+	}
+	if exitCode == 0 && t.queueOnly && s.MigrationID != "" {
+		// a queue-only migration is still running on the target, it's followed like any other in flight
+		return *s
+	}
+	if exitCode == 0 {
+		t.transition(s, RepoSucceeded)
+		return *s
+	}
+	t.transition(s, RepoFailed)
+	if s.Error == "" {
+		s.Error = fmt.Sprintf("exit status %d", exitCode)
+	}
+	return *s
+}
+
+// beginStep marks a migration step of repo as started.
+func (t *repoTracker) beginStep(repo string, step MigrationStep) RepoStatus {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	s := t.get(repo)
+	if i := slices.IndexFunc(s.Steps, func(st StepStatus) bool { return st.Name == step.Name }); i != -1 {
+		s.Steps[i].State = RepoInProgress
+	}
+	return *s
+}
+
+// stepExited records the outcome of a migration step of repo, and the last error its command logged if it failed.
+func (t *repoTracker) stepExited(repo string, step MigrationStep, exitCode int, lastError string) RepoStatus {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	s := t.get(repo)
+	i := slices.IndexFunc(s.Steps, func(st StepStatus) bool { return st.Name == step.Name })
+	if i == -1 {
+		return *s
+	}
+	st := &s.Steps[i]
+	st.ExitCode = &exitCode
+	st.State = RepoSucceeded
+	if exitCode != 0 {
+		st.State = RepoFailed
+		st.Error = lastError
+		if st.Error == "" {
+			st.Error = fmt.Sprintf("exit status %d", exitCode)
+		}
+	}
+	return *s
+}
+
+// transition moves s to state. The caller must hold mu.
+func (t *repoTracker) transition(s *RepoStatus, state RepoState) {
+	s.State = state
+	if s.StartedAt.IsZero() {
+		s.StartedAt = time.Now()
+	}
+	if s.Done() {
+		s.FinishedAt = time.Now()
+	}
+	if state == RepoFailed && s.Error == "" {
+		s.Error = t.lastErrors[s.Repo]
+	}
+}
+
+// repoLine labels a line of a repo's command output, since the output of concurrent commands is interleaved.
+func repoLine(repo string, line string) string {
+	return fmt.Sprintf("[%s] %s", repo, line)
+}
+
+// RepoOutput picks the lines of a run's output that belong to repo.
+func RepoOutput(output []string, repo string) []string {
+	prefix := repoLine(repo, "")
+	var lines []string
+	for _, line := range output {
+		if strings.HasPrefix(line, prefix) {
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
+
+// geiState maps a GitHub repository migration state to a RepoState.
+func geiState(state string) RepoState {
+	switch state {
+	case "QUEUED":
+		return RepoQueued
+	case "SUCCEEDED":
+		return RepoSucceeded
+	case "FAILED", "FAILED_VALIDATION":
+		return RepoFailed
+	default:
+		return RepoInProgress
+	}
+}
@@ -0,0 +1,84 @@
+package services
+
+import "testing"
+
+func TestRepoTrackerParse(t *testing.T) {
+	tests := []struct {
+		name        string
+		lines       []string
+		exitCode    int
+		queueOnly   bool
+		state       RepoState
+		migrationID string
+		err         string
+	}{
+		{
+			name: "succeeded",
+			lines: []string{
+				"[INFO] A repository migration (ID: RM_abc) was successfully queued.",
+				"[INFO] Migration in progress (ID: RM_abc). State: IN_PROGRESS. Waiting 10 seconds...",
+				"[INFO] Migration completed (ID: RM_abc)! State: SUCCEEDED",
+			},
+			state:       RepoSucceeded,
+			migrationID: "RM_abc",
+		},
+		{
+			name: "failed with reason",
+			lines: []string{
+				"[INFO] A repository migration (ID: RM_abc) was successfully queued.",
+				"[ERROR] Migration Failed. Migration ID: RM_abc",
+				"[ERROR] Repository has blobs larger than 2 GiB",
+			},
+			exitCode:    1,
+			state:       RepoFailed,
+			migrationID: "RM_abc",
+			err:         "Repository has blobs larger than 2 GiB",
+		},
+		{
+			name: "failed before queuing",
+			lines: []string{
+				"[ERROR] Target repository already exists",
+			},
+			exitCode: 1,
+			state:    RepoFailed,
+			err:      "Target repository already exists",
+		},
+		{
+			name:     "exited without output",
+			exitCode: 2,
+			state:    RepoFailed,
+			err:      "exit status 2",
+		},
+		{
+			name: "queue only",
+			lines: []string{
+				"[INFO] A repository migration (ID: RM_abc) was successfully queued.",
+			},
+			queueOnly:   true,
+			state:       RepoQueued,
+			migrationID: "RM_abc",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tracker := newRepoTracker(Migration{
+				SourceRepos: []string{"repo"},
+				Options:     MigrationOptions{QueueOnly: tt.queueOnly},
+			})
+			tracker.begin("repo")
+			for _, line := range tt.lines {
+				tracker.parse("repo", line)
+			}
+			status := tracker.exited("repo", tt.exitCode)
+			if status.State != tt.state {
+				t.Errorf("got state %s, want %s", status.State, tt.state)
+			}
+			if status.MigrationID != tt.migrationID {
+				t.Errorf("got migration ID %q, want %q", status.MigrationID, tt.migrationID)
+			}
+			if status.Error != tt.err {
+				t.Errorf("got error %q, want %q", status.Error, tt.err)
+			}
+		})
+	}
+}
@@ -0,0 +1,478 @@
+package services
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/gorilla/securecookie"
+	bolt "go.etcd.io/bbolt"
+)
+
+var (
+	runsBucket        = []byte("runs")
+	outputBucket      = []byte("output")
+	credentialsBucket = []byte("credentials")
+	// activeBucket indexes the IDs of runs that haven't finished, scheduled ones included, so the scheduler and
+	// tracker don't have to read the whole history every time they check
+	activeBucket = []byte("active")
+)
+
+var (
+	ErrRunNotFound         = errors.New("run not found")
+	ErrCredentialsNotFound = errors.New("credentials not found")
+	// ErrCredentialsUnreadable is returned for credentials saved with session keys that have since changed
+	ErrCredentialsUnreadable = errors.New("credentials can't be decrypted")
+)
+
+// Credentials are the tokens an active run needs to keep working without the session that started it.
+type Credentials struct {
+	SourceToken    string
+	SourceUsername string // for sources that authenticate users by name
+	SourceApp      bool   // authenticate as the source's GitHub App, SourceToken is empty
+	TargetToken    string
+	TargetApp      bool // authenticate as the target's GitHub App, TargetToken is empty
+}
+
+func (c Credentials) sourceToken() Token {
+	return Token{PersonalAccess: c.SourceToken, Type: Source, Username: c.SourceUsername, App: c.SourceApp}
+}
+
+type RunStatus string
+
+const (
+	RunScheduled RunStatus = "scheduled"
+	RunQueued    RunStatus = "queued"
+	RunRunning   RunStatus = "running"
+	RunSucceeded RunStatus = "succeeded"
+	RunFailed    RunStatus = "failed"
+	RunCancelled RunStatus = "cancelled"
+)
+
+// RunRecord is the persisted history of a single migration run, or of a change to the target org's migrator role.
+type RunRecord struct {
+	ID             string
+	RoleChange     *MigratorRoleChange // nil for migrations
+	Reclaims       []MannequinReclaim  // empty for migrations
+	Source         SourceKind          // empty for runs from before other sources were supported, which were GitHub's
+	SourceInstance string              // named instance of Source, if several are configured
+	SourceOrg      string
+	SourceRepos    []string // empty when every repo in SourceOrg was migrated
+	TargetOrg      string
+	TargetNaming   TargetNaming
+	Options        MigrationOptions
+	DryRun         bool
+	RetryOf        string         // run whose failed repos this run retries
+	Plan           *MigrationPlan // recorded by dry runs
+	Repos          []RepoStatus
+	ScheduledFor   time.Time
+	QueuedAt       time.Time
+	StartedAt      time.Time
+	FinishedAt     time.Time
+	Status         RunStatus
+	ExitCode       int
+	Output         []string `json:"-"` // stored separately, line by line
+}
+
+// Finished reports whether the run has completed (successfully or not).
+func (r RunRecord) Finished() bool {
+	return r.Status == RunSucceeded || r.Status == RunFailed || r.Status == RunCancelled
+}
+
+// sortedAt is when the run is listed as happening: when it was queued, or for a run that never was (e.g. cancelled
+// while scheduled), when it was due to be.
+func (r RunRecord) sortedAt() time.Time {
+	if r.QueuedAt.IsZero() {
+		return r.ScheduledFor
+	}
+	return r.QueuedAt
+}
+
+// compareRuns orders runs as they're listed: scheduled runs first, the next to start first (including any that were
+// due while the server was down), then the rest most recent first.
+func compareRuns(a, b RunRecord) int {
+	aScheduled, bScheduled := a.Status == RunScheduled, b.Status == RunScheduled
+	switch {
+	case aScheduled && bScheduled:
+		return a.ScheduledFor.Compare(b.ScheduledFor)
+	case aScheduled:
+		return -1
+	case bScheduled:
+		return 1
+	}
+	return b.sortedAt().Compare(a.sortedAt())
+}
+
+// FailedRepos lists the repos that ended in a failed state.
+func (r RunRecord) FailedRepos() []string {
+	var failed []string
+	for _, repo := range r.Repos {
+		if repo.State == RepoFailed {
+			failed = append(failed, repo.Repo)
+		}
+	}
+	return failed
+}
+
+type RunStore interface {
+	CreateRun(r RunRecord) error
+	ScheduleRun(id string, edit ScheduleEdit) error
+	QueueRun(id string) error
+	StartRun(id string) error
+	AppendOutput(id string, lines ...string) error
+	OutputFrom(id string, from int) ([]string, bool, error)
+	FinishRun(id string, exitCode int) error
+	CancelRun(id string) error
+	SavePlan(id string, plan MigrationPlan) error
+	SaveRepoStatuses(id string, statuses ...RepoStatus) error
+	SaveReclaims(id string, reclaims ...MannequinReclaim) error
+	SaveCredentials(id string, c Credentials) error
+	Credentials(id string) (Credentials, error)
+	Run(id string) (RunRecord, error)
+	Runs() ([]RunRecord, error)
+	ActiveRuns() ([]RunRecord, error)
+}
+
+// NewRunStore opens (creating if necessary) the bbolt database at path. Credentials are encrypted at rest
+// with codecs (the session cookie codecs) and only kept until their run finishes.
+func NewRunStore(path string, codecs ...securecookie.Codec) (RunStore, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: 1 * time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("error opening run store: %w", err)
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{runsBucket, outputBucket, credentialsBucket} {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+		if tx.Bucket(activeBucket) != nil {
+			return nil
+		}
+		// a store from before the index, so it's built from the runs there are
+		active, err := tx.CreateBucket(activeBucket)
+		if err != nil {
+			return err
+		}
+		return tx.Bucket(runsBucket).ForEach(func(k, v []byte) error {
+			var r RunRecord
+			if err := json.Unmarshal(v, &r); err != nil {
+				return err
+			}
+			if r.Finished() {
+				return nil
+			}
+			return active.Put(k, []byte{})
+		})
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error initializing run store: %w", err)
+	}
+	return &BoltRunStore{db: db, codecs: codecs}, nil
+}
+
+type BoltRunStore struct {
+	db     *bolt.DB
+	codecs []securecookie.Codec
+}
+
+func (rs *BoltRunStore) CreateRun(r RunRecord) error {
+	if r.Status == "" {
+		r.Status = RunQueued
+	}
+	return rs.db.Update(func(tx *bolt.Tx) error {
+		if _, err := tx.Bucket(outputBucket).CreateBucketIfNotExists([]byte(r.ID)); err != nil {
+			return err
+		}
+		return putRun(tx, r)
+	})
+}
+
+func (rs *BoltRunStore) ScheduleRun(id string, edit ScheduleEdit) error {
+	return rs.db.Update(func(tx *bolt.Tx) error {
+		r, err := getRun(tx, id)
+		if err != nil {
+			return err
+		}
+		r.ScheduledFor = edit.ScheduledFor
+		r.SourceRepos = edit.SourceRepos
+		r.Options = edit.Options
+		return putRun(tx, r)
+	})
+}
+
+func (rs *BoltRunStore) QueueRun(id string) error {
+	return rs.db.Update(func(tx *bolt.Tx) error {
+		r, err := getRun(tx, id)
+		if err != nil {
+			return err
+		}
+		r.QueuedAt = time.Now()
+		r.Status = RunQueued
+		return putRun(tx, r)
+	})
+}
+
+func (rs *BoltRunStore) StartRun(id string) error {
+	return rs.db.Update(func(tx *bolt.Tx) error {
+		r, err := getRun(tx, id)
+		if err != nil {
+			return err
+		}
+		r.StartedAt = time.Now()
+		r.Status = RunRunning
+		return putRun(tx, r)
+	})
+}
+
+// AppendOutput is called for every line of every running repo's output, so concurrent appends are batched into one
+// transaction (and one fsync) rather than each waiting its turn for the database's single writer.
+func (rs *BoltRunStore) AppendOutput(id string, lines ...string) error {
+	return rs.db.Batch(func(tx *bolt.Tx) error {
+		b := tx.Bucket(outputBucket).Bucket([]byte(id))
+		if b == nil {
+			return ErrRunNotFound
+		}
+		for _, line := range lines {
+			seq, err := b.NextSequence()
+			if err != nil {
+				return err
+			}
+			key := make([]byte, 8)
+			binary.BigEndian.PutUint64(key, seq)
+			if err := b.Put(key, []byte(line)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// OutputFrom returns a run's output after its first from lines, and whether the run had finished when they were read
+// (so there's no more to come).
+func (rs *BoltRunStore) OutputFrom(id string, from int) ([]string, bool, error) {
+	var lines []string
+	var finished bool
+	err := rs.db.View(func(tx *bolt.Tx) error {
+		r, err := getRun(tx, id)
+		if err != nil {
+			return err
+		}
+		finished = r.Finished()
+		b := tx.Bucket(outputBucket).Bucket([]byte(id))
+		if b == nil {
+			return nil
+		}
+		// sequences start at 1
+		start := make([]byte, 8)
+		binary.BigEndian.PutUint64(start, uint64(max(from, 0))+1)
+		c := b.Cursor()
+		for k, v := c.Seek(start); k != nil; k, v = c.Next() {
+			lines = append(lines, string(v))
+		}
+		return nil
+	})
+	return lines, finished, err
+}
+
+func (rs *BoltRunStore) FinishRun(id string, exitCode int) error {
+	return rs.db.Update(func(tx *bolt.Tx) error {
+		r, err := getRun(tx, id)
+		if err != nil {
+			return err
+		}
+		if err := tx.Bucket(credentialsBucket).Delete([]byte(id)); err != nil {
+			return err
+		}
+		r.FinishedAt = time.Now()
+		r.ExitCode = exitCode
+		if exitCode == 0 {
+			r.Status = RunSucceeded
+		} else {
+			r.Status = RunFailed
+		}
+		return putRun(tx, r)
+	})
+}
+
+func (rs *BoltRunStore) CancelRun(id string) error {
+	return rs.db.Update(func(tx *bolt.Tx) error {
+		r, err := getRun(tx, id)
+		if err != nil {
+			return err
+		}
+		if err := tx.Bucket(credentialsBucket).Delete([]byte(id)); err != nil {
+			return err
+		}
+		r.FinishedAt = time.Now()
+		r.Status = RunCancelled
+		return putRun(tx, r)
+	})
+}
+
+func (rs *BoltRunStore) SavePlan(id string, plan MigrationPlan) error {
+	return rs.db.Update(func(tx *bolt.Tx) error {
+		r, err := getRun(tx, id)
+		if err != nil {
+			return err
+		}
+		r.Plan = &plan
+		return putRun(tx, r)
+	})
+}
+
+// SaveRepoStatuses adds or replaces the statuses of the given repos.
+func (rs *BoltRunStore) SaveRepoStatuses(id string, statuses ...RepoStatus) error {
+	return rs.db.Update(func(tx *bolt.Tx) error {
+		r, err := getRun(tx, id)
+		if err != nil {
+			return err
+		}
+		for _, status := range statuses {
+			i := slices.IndexFunc(r.Repos, func(s RepoStatus) bool { return s.Repo == status.Repo })
+			if i == -1 {
+				r.Repos = append(r.Repos, status)
+			} else {
+				r.Repos[i] = status
+			}
+		}
+		return putRun(tx, r)
+	})
+}
+
+// SaveReclaims replaces the given mannequins' reclaims.
+func (rs *BoltRunStore) SaveReclaims(id string, reclaims ...MannequinReclaim) error {
+	return rs.db.Update(func(tx *bolt.Tx) error {
+		r, err := getRun(tx, id)
+		if err != nil {
+			return err
+		}
+		for _, reclaim := range reclaims {
+			i := slices.IndexFunc(r.Reclaims, func(rc MannequinReclaim) bool { return rc.MannequinID == reclaim.MannequinID })
+			if i == -1 {
+				return fmt.Errorf("error saving reclaim: run %s has no reclaim of %s", id, reclaim.MannequinUser)
+			}
+			r.Reclaims[i] = reclaim
+		}
+		return putRun(tx, r)
+	})
+}
+
+func (rs *BoltRunStore) SaveCredentials(id string, c Credentials) error {
+	sealed, err := securecookie.EncodeMulti(string(credentialsBucket), c, rs.codecs...)
+	if err != nil {
+		return fmt.Errorf("error encrypting credentials: %w", err)
+	}
+	return rs.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(credentialsBucket).Put([]byte(id), []byte(sealed))
+	})
+}
+
+func (rs *BoltRunStore) Credentials(id string) (Credentials, error) {
+	var sealed string
+	var c Credentials
+	err := rs.db.View(func(tx *bolt.Tx) error {
+		sealed = string(tx.Bucket(credentialsBucket).Get([]byte(id)))
+		return nil
+	})
+	if err != nil {
+		return c, fmt.Errorf("error reading credentials: %w", err)
+	}
+	if sealed == "" {
+		return c, ErrCredentialsNotFound
+	}
+	// fails if the session keys changed since the credentials were saved (e.g. generated keys and a restart)
+	if err := securecookie.DecodeMulti(string(credentialsBucket), sealed, &c, rs.codecs...); err != nil {
+		return c, fmt.Errorf("%w: %w", ErrCredentialsUnreadable, err)
+	}
+	return c, nil
+}
+
+func (rs *BoltRunStore) Run(id string) (RunRecord, error) {
+	var r RunRecord
+	err := rs.db.View(func(tx *bolt.Tx) error {
+		var err error
+		r, err = getRun(tx, id)
+		if err != nil {
+			return err
+		}
+		b := tx.Bucket(outputBucket).Bucket([]byte(id))
+		if b == nil {
+			return nil
+		}
+		return b.ForEach(func(_, v []byte) error {
+			r.Output = append(r.Output, string(v))
+			return nil
+		})
+	})
+	return r, err
+}
+
+// Runs returns every recorded run, scheduled runs first and then the most recent, without output.
+func (rs *BoltRunStore) Runs() ([]RunRecord, error) {
+	var runs []RunRecord
+	err := rs.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(runsBucket).ForEach(func(_, v []byte) error {
+			var r RunRecord
+			if err := json.Unmarshal(v, &r); err != nil {
+				return err
+			}
+			runs = append(runs, r)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	slices.SortFunc(runs, compareRuns)
+	return runs, nil
+}
+
+// ActiveRuns returns the runs that haven't finished, scheduled runs included, in the same order as Runs.
+func (rs *BoltRunStore) ActiveRuns() ([]RunRecord, error) {
+	var runs []RunRecord
+	err := rs.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(activeBucket).ForEach(func(k, _ []byte) error {
+			r, err := getRun(tx, string(k))
+			if err != nil {
+				return err
+			}
+			runs = append(runs, r)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	slices.SortFunc(runs, compareRuns)
+	return runs, nil
+}
+
+func getRun(tx *bolt.Tx, id string) (RunRecord, error) {
+	var r RunRecord
+	v := tx.Bucket(runsBucket).Get([]byte(id))
+	if v == nil {
+		return r, ErrRunNotFound
+	}
+	err := json.Unmarshal(v, &r)
+	return r, err
+}
+
+func putRun(tx *bolt.Tx, r RunRecord) error {
+	v, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	if r.Finished() {
+		err = tx.Bucket(activeBucket).Delete([]byte(r.ID))
+	} else {
+		err = tx.Bucket(activeBucket).Put([]byte(r.ID), []byte{})
+	}
+	if err != nil {
+		return err
+	}
+	return tx.Bucket(runsBucket).Put([]byte(r.ID), v)
+}
@@ -0,0 +1,88 @@
+package services
+
+import (
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+func activeRunIDs(t *testing.T, store RunStore) []string {
+	t.Helper()
+	runs, err := store.ActiveRuns()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ids []string
+	for _, run := range runs {
+		ids = append(ids, run.ID)
+	}
+	return ids
+}
+
+func TestActiveRuns(t *testing.T) {
+	store, err := NewRunStore(filepath.Join(t.TempDir(), "runs.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	for _, run := range []RunRecord{
+		{ID: "queued", QueuedAt: now},
+		{ID: "scheduled", Status: RunScheduled, ScheduledFor: now.Add(time.Hour)},
+		{ID: "finished", QueuedAt: now.Add(-time.Hour)},
+	} {
+		if err := store.CreateRun(run); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := store.FinishRun("finished", 0); err != nil {
+		t.Fatal(err)
+	}
+	if ids, want := activeRunIDs(t, store), []string{"scheduled", "queued"}; !slices.Equal(ids, want) {
+		t.Errorf("got active runs %v, want %v", ids, want)
+	}
+
+	if err := store.CancelRun("scheduled"); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.StartRun("queued"); err != nil {
+		t.Fatal(err)
+	}
+	if ids, want := activeRunIDs(t, store), []string{"queued"}; !slices.Equal(ids, want) {
+		t.Errorf("got active runs %v, want %v", ids, want)
+	}
+}
+
+func TestActiveRunsIndexesExistingStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "runs.db")
+	store, err := NewRunStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, run := range []RunRecord{{ID: "running", Status: RunRunning}, {ID: "finished"}} {
+		if err := store.CreateRun(run); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := store.FinishRun("finished", 1); err != nil {
+		t.Fatal(err)
+	}
+	// as a store from before the index was
+	db := store.(*BoltRunStore).db
+	if err := db.Update(func(tx *bolt.Tx) error { return tx.DeleteBucket(activeBucket) }); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	store, err = NewRunStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ids, want := activeRunIDs(t, store), []string{"running"}; !slices.Equal(ids, want) {
+		t.Errorf("got active runs %v, want %v", ids, want)
+	}
+}
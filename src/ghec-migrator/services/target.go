@@ -0,0 +1,61 @@
+package services
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// GitHubTarget is where repos are migrated to: GitHub.com, or a GHE.com data-residency tenant.
+type GitHubTarget struct {
+	URL   string     // GHE.com tenant URL, e.g. https://acme.ghe.com, empty for GitHub.com
+	App   *GitHubApp // optional
+	OAuth *OAuthApp  // optional
+}
+
+// NewGitHubTarget checks tenantURL is a GHE.com tenant, or empty for GitHub.com.
+func NewGitHubTarget(tenantURL string) (GitHubTarget, error) {
+	if tenantURL == "" {
+		return GitHubTarget{}, nil
+	}
+	u, err := url.Parse(tenantURL)
+	if err != nil || u.Scheme != "https" || !strings.HasSuffix(u.Host, ".ghe.com") || strings.Trim(u.Path, "/") != "" {
+		return GitHubTarget{}, fmt.Errorf("invalid GHE.com target %q, expected https://SUBDOMAIN.ghe.com", tenantURL)
+	}
+	return GitHubTarget{URL: "https://" + u.Host}, nil
+}
+
+// APIURL is the tenant's API, which lives on an api. subdomain, or empty for GitHub.com.
+func (t GitHubTarget) APIURL() string {
+	if t.URL == "" {
+		return ""
+	}
+	return strings.Replace(t.URL, "https://", "https://api.", 1)
+}
+
+func (t GitHubTarget) TokenURL() string {
+	url := t.URL
+	if url == "" {
+		url = "https://github.com"
+	}
+	return fmt.Sprintf("%s/settings/tokens/new", url)
+}
+
+// token is the token for org, an installation token when credentials authenticate as the target's GitHub App.
+func (t GitHubTarget) token(credentials Credentials, org string) (string, error) {
+	if !credentials.TargetApp {
+		return credentials.TargetToken, nil
+	}
+	if t.App == nil {
+		return "", ErrAppNotConfigured
+	}
+	return t.App.InstallationToken(org)
+}
+
+// args point GEI at the tenant, all of gei, ado2gh and bbs2gh taking the same flag.
+func (t GitHubTarget) args() []string {
+	if t.URL == "" {
+		return nil
+	}
+	return []string{"--target-api-url", t.APIURL()}
+}
@@ -0,0 +1,28 @@
+package services
+
+import "testing"
+
+func TestNewGitHubTarget(t *testing.T) {
+	tests := []struct {
+		url    string
+		apiURL string
+		err    bool
+	}{
+		{url: "", apiURL: ""},
+		{url: "https://acme-eu.ghe.com", apiURL: "https://api.acme-eu.ghe.com"},
+		{url: "https://acme-eu.ghe.com/", apiURL: "https://api.acme-eu.ghe.com"},
+		{url: "http://acme-eu.ghe.com", err: true},
+		{url: "https://github.acme.com", err: true},
+		{url: "https://acme-eu.ghe.com/orgs", err: true},
+	}
+	for _, tt := range tests {
+		target, err := NewGitHubTarget(tt.url)
+		if (err != nil) != tt.err {
+			t.Errorf("%q: got error %v", tt.url, err)
+			continue
+		}
+		if got := target.APIURL(); got != tt.apiURL {
+			t.Errorf("%q: got API URL %q, want %q", tt.url, got, tt.apiURL)
+		}
+	}
+}
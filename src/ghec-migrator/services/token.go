@@ -9,20 +9,33 @@ import (
 )
 
 const (
-	sessionName = "ghec-migrator"
+	sessionName    = "ghec-migrator"
+	oauthStateName = "oauth-state"
 )
 
 var ErrTokenNotFound = errors.New("missing token")
 
 type Token struct {
-	PersonalAccess string
+	PersonalAccess string // or password, for Bitbucket Server
+	OAuth          bool   // PersonalAccess is from signing in with the side's OAuth App
+	App            bool   // authenticate as the side's GitHub App instead of with PersonalAccess
 	Type           ClientType
+	SourceKind     SourceKind // for source tokens, empty for GitHub
+	SourceInstance string     // for source tokens, when several instances of their kind are configured
+	Username       string     // for sources that authenticate users by name
+
+	// App tokens are vouched for by the OAuth token of the user who signed in before switching to the app, whose org
+	// role gates what the app is used for, or by the app's admin secret
+	Identity string
+	Admin    bool
 }
 
 type TokenService interface {
 	ClearSession(c echo.Context)
 	StoreToken(c echo.Context, t Token) error
 	Token(c echo.Context, t ClientType) (Token, error)
+	StoreOAuthState(c echo.Context, s OAuthState) error
+	TakeOAuthState(c echo.Context) (OAuthState, error)
 }
 
 func NewTokenService(sessionStore *sessions.CookieStore) TokenService {
@@ -74,3 +87,38 @@ func (ts *TokenServiceImpl) Token(c echo.Context, e ClientType) (Token, error) {
 	}
 	return *token, nil
 }
+
+// StoreOAuthState remembers the sign-in being started, replacing any the user abandoned.
+func (ts *TokenServiceImpl) StoreOAuthState(c echo.Context, s OAuthState) error {
+	session, err := ts.sessionStore.Get(c.Request(), ts.sessionName)
+	if err != nil {
+		return err
+	}
+	stateJSON, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+	session.Values[oauthStateName] = stateJSON
+	return session.Save(c.Request(), c.Response())
+}
+
+// TakeOAuthState returns the sign-in in progress and forgets it, so a callback can't be replayed.
+func (ts *TokenServiceImpl) TakeOAuthState(c echo.Context) (OAuthState, error) {
+	session, err := ts.sessionStore.Get(c.Request(), ts.sessionName)
+	if err != nil {
+		return OAuthState{}, ErrOAuthState
+	}
+	stateJSON, ok := session.Values[oauthStateName].([]byte)
+	if !ok {
+		return OAuthState{}, ErrOAuthState
+	}
+	delete(session.Values, oauthStateName)
+	if err := session.Save(c.Request(), c.Response()); err != nil {
+		return OAuthState{}, err
+	}
+	state := new(OAuthState)
+	if err := json.Unmarshal(stateJSON, state); err != nil {
+		return OAuthState{}, err
+	}
+	return *state, nil
+}
@@ -0,0 +1,233 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"time"
+)
+
+const (
+	trackerInterval = 30 * time.Second
+	// trackerMaxMisses is how many polls in a row (about 10 minutes' worth) a migration can go unreported, missing from
+	// the API's response or with the API failing, before its repo is failed so the run can finish
+	trackerMaxMisses = 20
+)
+
+// tracker periodically reconciles runs that have no live job (their process died, or the server restarted
+// mid-migration) against the target's migration API, so their status doesn't depend on stdout alone.
+func (ms *MigratorServiceImpl) tracker() {
+	for {
+		runs, err := ms.runStore.ActiveRuns()
+		if err != nil {
+			log.Printf("error listing runs to track: %v", err)
+		}
+		for _, run := range runs {
+			ms.track(run)
+		}
+		time.Sleep(trackerInterval)
+	}
+}
+
+// track reconciles a run from the tracker's list if nothing else is looking after it.
+func (ms *MigratorServiceImpl) track(run RunRecord) {
+	if run.Finished() || run.Status == RunScheduled {
+		return
+	}
+	if run.RoleChange != nil || len(run.Reclaims) != 0 {
+		// these run in the server's own goroutines, so only a restart orphans them
+		if run.QueuedAt.Before(ms.startedAt) {
+			ms.interrupted(run)
+		}
+		return
+	}
+	if _, ok := activeJobs.Load(run.ID); ok {
+		return
+	}
+	// the list can predate a job finishing the run and letting go of it, which the store knows about by now
+	current, err := ms.runStore.Run(run.ID)
+	if err != nil {
+		log.Printf("error reading run %s: %v", run.ID, err)
+		return
+	}
+	if current.Finished() {
+		return
+	}
+	ms.reconcile(current)
+}
+
+// reconcile updates an orphaned run's repos from the migration API and finishes the run once nothing is in flight.
+func (ms *MigratorServiceImpl) reconcile(run RunRecord) {
+	var migrationIDs []string
+	for _, repo := range run.Repos {
+		if repo.MigrationID != "" && !repo.Done() {
+			migrationIDs = append(migrationIDs, repo.MigrationID)
+		}
+	}
+	if len(migrationIDs) != 0 {
+		migrations, err := ms.repositoryMigrations(run, migrationIDs)
+		if errors.Is(err, ErrCredentialsNotFound) || errors.Is(err, ErrCredentialsUnreadable) {
+			// there's no getting them back, so nothing can be followed
+			ms.recordOutput(run.ID, fmt.Sprintf("unable to follow repository migrations: %v", err))
+			ms.finishRun(run.ID, -1)
+			return
+		}
+		if err != nil {
+			log.Printf("error tracking migrations for run %s: %v", run.ID, err)
+		}
+		var updated []RepoStatus
+		for _, repo := range run.Repos {
+			if repo.MigrationID == "" || repo.Done() {
+				continue
+			}
+			i := slices.IndexFunc(migrations, func(m RepositoryMigration) bool { return m.ID == repo.MigrationID })
+			if i == -1 {
+				if !ms.missed(repo.MigrationID) {
+					continue
+				}
+				repo.State = RepoFailed
+				repo.FinishedAt = time.Now()
+				repo.Error = "its migration stopped being reported by the migration API"
+				if err != nil {
+					repo.Error = fmt.Sprintf("unable to follow its migration: %v", err)
+				}
+				updated = append(updated, repo)
+				ms.recordOutput(run.ID, fmt.Sprintf("%s: %s (%s)", repo.Repo, repo.State, repo.Error))
+				continue
+			}
+			ms.heard(repo.MigrationID)
+			if status, changed := applyMigrationState(repo, migrations[i]); changed {
+				updated = append(updated, status)
+				ms.recordOutput(run.ID, fmt.Sprintf("%s: %s (from migration API)", status.Repo, status.State))
+			}
+		}
+		if err := ms.runStore.SaveRepoStatuses(run.ID, updated...); err != nil {
+			log.Printf("error recording repo status for run %s: %v", run.ID, err)
+		}
+		if countDone(updated) != len(migrationIDs) {
+			return
+		}
+	}
+
+	// nothing is in flight any more, and with no process left nothing else will be started
+	current, err := ms.runStore.Run(run.ID)
+	if err != nil {
+		log.Printf("error reading run %s: %v", run.ID, err)
+		return
+	}
+	exitCode := 0
+	var unfinished []RepoStatus
+	for _, repo := range current.Repos {
+		changed := false
+		if repo.MigrationID == "" && !repo.Done() {
+			repo.State = RepoFailed
+			repo.Error = "not started, the run was interrupted"
+			changed = true
+		}
+		// steps only run in the process that migrated the repo
+		for i, step := range repo.Steps {
+			if !step.Done() {
+				repo.Steps[i].State = RepoFailed
+				repo.Steps[i].Error = "not run, the run was interrupted"
+				changed = true
+			}
+		}
+		if changed {
+			unfinished = append(unfinished, repo)
+		}
+	}
+	if err := ms.runStore.SaveRepoStatuses(run.ID, unfinished...); err != nil {
+		log.Printf("error recording repo status for run %s: %v", run.ID, err)
+	}
+	finished, err := ms.runStore.Run(run.ID)
+	if err != nil {
+		log.Printf("error reading run %s: %v", run.ID, err)
+		return
+	}
+	for _, repo := range finished.Repos {
+		if repo.State != RepoSucceeded || slices.ContainsFunc(repo.Steps, func(s StepStatus) bool { return s.State != RepoSucceeded }) {
+			exitCode = 1
+		}
+	}
+	if len(finished.Repos) == 0 {
+		exitCode = -1
+	}
+	ms.recordOutput(run.ID, "run was interrupted, finished from the migration API")
+	ms.finishRun(run.ID, exitCode)
+}
+
+// repositoryMigrations asks the target about a run's migrations, with the credentials the run saved.
+func (ms *MigratorServiceImpl) repositoryMigrations(run RunRecord, migrationIDs []string) ([]RepositoryMigration, error) {
+	credentials, err := ms.runStore.Credentials(run.ID)
+	if err != nil {
+		return nil, err
+	}
+	targetToken, err := ms.target.token(credentials, run.TargetOrg)
+	if err != nil {
+		return nil, err
+	}
+	return ms.gitHubService.RepositoryMigrations(targetToken, migrationIDs)
+}
+
+// missed counts a poll that didn't hear about a migration, and reports whether it's time to give up on it.
+func (ms *MigratorServiceImpl) missed(migrationID string) bool {
+	ms.missesMutex.Lock()
+	defer ms.missesMutex.Unlock()
+	ms.misses[migrationID]++
+	if ms.misses[migrationID] < trackerMaxMisses {
+		return false
+	}
+	delete(ms.misses, migrationID)
+	return true
+}
+
+func (ms *MigratorServiceImpl) heard(migrationID string) {
+	ms.missesMutex.Lock()
+	defer ms.missesMutex.Unlock()
+	delete(ms.misses, migrationID)
+}
+
+// interrupted fails a migrator role change or mannequin reclaim run the server restarted in the middle of, along with
+// the reclaims it hadn't submitted yet. There's no API to follow them through, so they have to be submitted again.
+func (ms *MigratorServiceImpl) interrupted(run RunRecord) {
+	var unsubmitted []MannequinReclaim
+	for _, reclaim := range run.Reclaims {
+		if reclaim.ExitCode == nil {
+			exitCode := -1
+			reclaim.ExitCode = &exitCode
+			unsubmitted = append(unsubmitted, reclaim)
+		}
+	}
+	if err := ms.runStore.SaveReclaims(run.ID, unsubmitted...); err != nil {
+		log.Printf("error recording reclaims for run %s: %v", run.ID, err)
+	}
+	ms.recordOutput(run.ID, "run was interrupted by a restart")
+	ms.finishRun(run.ID, -1)
+}
+
+// applyMigrationState updates a repo's status from the target's view of its migration.
+func applyMigrationState(s RepoStatus, migration RepositoryMigration) (RepoStatus, bool) {
+	state := geiState(migration.State)
+	if state == s.State {
+		return s, false
+	}
+	s.State = state
+	if s.Done() {
+		s.FinishedAt = time.Now()
+	}
+	if state == RepoFailed && migration.FailureReason != "" {
+		s.Error = migration.FailureReason
+	}
+	return s, true
+}
+
+func countDone(statuses []RepoStatus) int {
+	n := 0
+	for _, s := range statuses {
+		if s.Done() {
+			n++
+		}
+	}
+	return n
+}